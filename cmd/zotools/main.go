@@ -11,17 +11,23 @@ import (
 	"os"
 
 	"github.com/acidghost/zotools/internal/act"
+	"github.com/acidghost/zotools/internal/collections"
 	"github.com/acidghost/zotools/internal/config"
 	"github.com/acidghost/zotools/internal/search"
 	"github.com/acidghost/zotools/internal/sync"
+	"github.com/acidghost/zotools/internal/tags"
 	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/whoami"
 	"github.com/fatih/color"
 )
 
 const (
-	actCmd    = "act"
-	searchCmd = "search"
-	syncCmd   = "sync"
+	actCmd         = "act"
+	collectionsCmd = "collections"
+	searchCmd      = "search"
+	syncCmd        = "sync"
+	tagsCmd        = "tags"
+	whoamiCmd      = "whoami"
 )
 
 var (
@@ -44,6 +50,12 @@ Available commands:
         search for items
   - %[4]s
         execute an action on previous search results
+  - %[5]s
+        print the tree of collections of each library
+  - %[6]s
+        list all the tags with the number of tagged items
+  - %[7]s
+        show the owner of the API key and what it can access
 
 For help on a specific command try: %[1]s command -h
 
@@ -52,7 +64,7 @@ Common options:
 
 func usage() {
 	fmt.Fprintf(flag.CommandLine.Output(), makeBanner()+"\n\n"+usageFmt, os.Args[0],
-		syncCmd, searchCmd, actCmd)
+		syncCmd, searchCmd, actCmd, collectionsCmd, tagsCmd, whoamiCmd)
 	flag.PrintDefaults()
 }
 
@@ -111,10 +123,16 @@ func main() {
 	switch args[0] {
 	case actCmd:
 		cmd = act.New(args[0], banner)
+	case collectionsCmd:
+		cmd = collections.New(args[0], banner)
 	case searchCmd:
 		cmd = search.New(args[0], banner)
 	case syncCmd:
 		cmd = sync.New(args[0], banner)
+	case tagsCmd:
+		cmd = tags.New(args[0], banner)
+	case whoamiCmd:
+		cmd = whoami.New(args[0], banner)
 	default:
 		utils.Die("Command '%s' not recognized\n", args[0])
 	}
@@ -6,5 +6,6 @@ require (
 	github.com/fatih/color v1.10.0
 	github.com/mattn/go-shellwords v1.0.11
 	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/text v0.3.5
 )
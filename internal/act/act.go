@@ -5,14 +5,18 @@
 package act
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"mime"
 	"os"
 	"os/exec"
+	"os/signal"
+	"runtime"
 	"strings"
 
 	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/files"
 	"github.com/acidghost/zotools/internal/storage"
 	"github.com/acidghost/zotools/internal/utils"
 	"github.com/mattn/go-shellwords"
@@ -20,6 +24,8 @@ import (
 
 const actUsageTop = " " + utils.OptionsUsage + " [cmd [arg...]]"
 
+const htmlType = "text/html"
+
 const actUsageBottom = `  cmd
         command and arguments to execute
 `
@@ -42,7 +48,10 @@ func (c *Command) Run(args []string, conf config.Config) {
 	//nolint:errcheck
 	c.fs.Parse(args)
 
-	store := storage.New(conf.Storage)
+	store, err := storage.FromConfig(conf)
+	if err != nil {
+		utils.Die("Failed to open the local storage:\n - %v\n", err)
+	}
 	if err := store.Load(); err != nil {
 		utils.Die("Failed to load storage:\n - %v\n", err)
 	}
@@ -51,8 +60,7 @@ func (c *Command) Run(args []string, conf config.Config) {
 
 	if *c.flagForget {
 		if search != nil {
-			store.Data.Search = nil
-			if err := store.Persist(); err != nil {
+			if err := store.PutSearch(nil); err != nil {
 				utils.Die("Failed to forget search:\n - %v\n", err)
 			}
 		}
@@ -67,45 +75,113 @@ func (c *Command) Run(args []string, conf config.Config) {
 	}
 
 	item := search.Items[*c.flagIdx]
-	path := utils.MakePath(conf.Zotero, item.Key, item.Filename)
-	fmt.Println(path)
+	file := files.FromSearchResult(&item)
+	target, err := files.Location(file, conf.Zotero, conf.LinkedBaseDir)
+	if err != nil {
+		utils.Die("Failed to locate attachment:\n - %v\n", err)
+	}
 
 	var cmdName string
 	var cmdArgs []string
 	if c.fs.NArg() == 0 {
-		extensions, err := mime.ExtensionsByType(item.ContentType)
-		if err != nil {
-			utils.Die("Could not parse MIME type: %v\n", err)
-		} else if extensions == nil {
-			utils.Die("Unknown extension for MIME type '%s'\n", item.ContentType)
-		}
-		for _, extension := range extensions {
-			varName := "ZOTOOLS_" + strings.ToUpper(extension[1:])
-			env := os.Getenv(varName)
-			if env != "" {
-				envArgs, err := shellwords.Parse(env)
-				if err != nil {
-					utils.Die("Failed to parse %s: %v\n", varName, err)
-				}
-				cmdName = envArgs[0]
-				//nolint:gocritic
-				cmdArgs = append(envArgs[1:], path)
-				break
-			}
-		}
-		if cmdName == "" {
-			utils.Die("Command not found for MIME type '%s'\n", item.ContentType)
+		if file.LinkMode == files.LinkedURL {
+			cmdName, cmdArgs = browserCommand()
+		} else {
+			cmdName, cmdArgs = mimeCommand(item.ContentType)
 		}
 	} else {
 		args = c.fs.Args()
-		cmdName = args[0]
-		//nolint:gocritic
-		cmdArgs = append(args[1:], path)
+		cmdName, cmdArgs = args[0], args[1:]
+	}
+	// Nothing is downloaded for a command that cannot run
+	cmdPath, err := exec.LookPath(cmdName)
+	if err != nil {
+		utils.Die("Failed to run action: %v\n", err)
 	}
 
-	cmd := exec.Command(cmdName, cmdArgs...)
+	if file.LinkMode != files.LinkedURL && !exists(target) {
+		if !file.Stored() {
+			utils.Die("Linked file %q not found\n", target)
+		}
+		target = fetchFile(file, conf)
+	}
+	fmt.Println(target)
+
+	cmd := exec.Command(cmdPath, append(cmdArgs, target)...)
 	cmd.Stdout = os.Stdout
 	if err := cmd.Run(); err != nil {
 		utils.Die("Failed to run action: %v\n", err)
 	}
 }
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil || !os.IsNotExist(err)
+}
+
+// envCommand parses the command in the environment variable, if set
+func envCommand(varName string) (string, []string) {
+	env := os.Getenv(varName)
+	if env == "" {
+		return "", nil
+	}
+	envArgs, err := shellwords.Parse(env)
+	if err != nil {
+		utils.Die("Failed to parse %s: %v\n", varName, err)
+	} else if len(envArgs) == 0 {
+		utils.Die("Empty command in %s\n", varName)
+	}
+	return envArgs[0], envArgs[1:]
+}
+
+// mimeCommand is the command set for the MIME type via ZOTOOLS_<EXT>, falling
+// back to the browser for web pages
+func mimeCommand(contentType string) (string, []string) {
+	extensions, err := mime.ExtensionsByType(contentType)
+	if err != nil {
+		utils.Die("Could not parse MIME type: %v\n", err)
+	} else if extensions == nil {
+		utils.Die("Unknown extension for MIME type '%s'\n", contentType)
+	}
+	for _, extension := range extensions {
+		varName := "ZOTOOLS_" + strings.ToUpper(extension[1:])
+		if cmdName, cmdArgs := envCommand(varName); cmdName != "" {
+			return cmdName, cmdArgs
+		}
+	}
+	if contentType == htmlType {
+		return browserCommand()
+	}
+	utils.Die("Command not found for MIME type '%s'\n", contentType)
+	return "", nil
+}
+
+// browserCommand opens URLs and web pages: ZOTOOLS_URL or BROWSER if set,
+// otherwise the default application of the system
+func browserCommand() (string, []string) {
+	for _, varName := range []string{"ZOTOOLS_URL", "BROWSER"} {
+		if cmdName, cmdArgs := envCommand(varName); cmdName != "" {
+			return cmdName, cmdArgs
+		}
+	}
+	if runtime.GOOS == "darwin" {
+		return "open", nil
+	}
+	return "xdg-open", nil
+}
+
+// fetchFile downloads a missing attachment from the WebDAV server, if
+// configured, or from Zotero Storage, until interrupted
+func fetchFile(file files.File, conf config.Config) string {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fetcher, err := files.FromConfig(ctx, conf)
+	if err != nil {
+		utils.Die("Failed to initialize attachments download:\n - %v\n", err)
+	}
+	path, err := fetcher.Fetch(ctx, file)
+	if err != nil {
+		utils.Die("Failed to download attachment:\n - %v\n", err)
+	}
+	return path
+}
@@ -0,0 +1,88 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package collections
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/fatih/color"
+)
+
+const collectionsUsageTop = " " + utils.OptionsUsage
+
+var (
+	libColor   = color.New(color.FgGreen, color.Bold)
+	countColor = color.New(color.FgBlue)
+)
+
+type Command struct {
+	fs *flag.FlagSet
+}
+
+func New(cmd, banner string) *Command {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.Usage = utils.MakeUsage(fs, cmd, banner, collectionsUsageTop, "")
+	return &Command{fs}
+}
+
+func (c *Command) Run(args []string, conf config.Config) {
+	//nolint:errcheck
+	c.fs.Parse(args)
+
+	store, err := storage.FromConfig(conf)
+	if err != nil {
+		utils.Die("Failed to open the local storage:\n - %v\n", err)
+	}
+	if err := store.Load(); err != nil {
+		utils.Die("Failed to load the local storage:\n - %v\n", err)
+	}
+
+	for i := range store.Data.Libs {
+		lib := &store.Data.Libs[i]
+		libColor.Println(lib.Name)
+		printTree(childrenOf(lib), itemsIn(lib), "", 1)
+	}
+}
+
+// childrenOf maps the key of each collection to its subcollections, sorted by
+// name; top level collections are under the empty key
+func childrenOf(lib *storage.Library) map[string][]storage.Collection {
+	children := make(map[string][]storage.Collection)
+	for _, coll := range lib.Collections {
+		children[coll.ParentKey] = append(children[coll.ParentKey], coll)
+	}
+	for _, colls := range children {
+		sort.Slice(colls, func(i, j int) bool {
+			return strings.ToLower(colls[i].Name) < strings.ToLower(colls[j].Name)
+		})
+	}
+	return children
+}
+
+// itemsIn counts the items that are directly in each collection
+func itemsIn(lib *storage.Library) map[string]int {
+	counts := make(map[string]int)
+	for i := range lib.Items {
+		for _, key := range lib.Items[i].Collections {
+			counts[key]++
+		}
+	}
+	return counts
+}
+
+func printTree(children map[string][]storage.Collection, counts map[string]int,
+	parent string, depth int) {
+	for _, coll := range children[parent] {
+		fmt.Printf("%s%s %s\n", strings.Repeat("  ", depth), coll.Name,
+			countColor.Sprintf("(%d)", counts[coll.Key]))
+		printTree(children, counts, coll.Key, depth+1)
+	}
+}
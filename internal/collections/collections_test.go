@@ -0,0 +1,40 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package collections
+
+import (
+	"testing"
+
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChildrenOf(t *testing.T) {
+	lib := storage.Library{
+		Collections: []storage.Collection{
+			{Key: "C1", Name: "Thesis"},
+			{Key: "C2", Name: "related work", ParentKey: "C1"},
+			{Key: "C3", Name: "Background", ParentKey: "C1"},
+			{Key: "C4", Name: "Archive"},
+		},
+	}
+	children := childrenOf(&lib)
+	assert.Len(t, children, 2)
+	assert.Equal(t, "Archive", children[""][0].Name)
+	assert.Equal(t, "Thesis", children[""][1].Name)
+	assert.Equal(t, "Background", children["C1"][0].Name)
+	assert.Equal(t, "related work", children["C1"][1].Name)
+}
+
+func TestItemsIn(t *testing.T) {
+	lib := storage.Library{
+		Items: []storage.Item{
+			{Key: "item1", Collections: []string{"C1", "C2"}},
+			{Key: "item2", Collections: []string{"C1"}},
+			{Key: "item3"},
+		},
+	}
+	assert.Equal(t, map[string]int{"C1": 2, "C2": 1}, itemsIn(&lib))
+}
@@ -10,15 +10,98 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/mattn/go-shellwords"
 )
 
 type Config struct {
 	Key     string
 	Zotero  string
 	Storage string
+	// How the storage is kept, "json" (default) or "bolt"
+	Backend string
+	WebDAV  *WebDAV
+	// Maximum number of attempts for each request to the Zotero API
+	MaxAttempts uint
+	// Base URL of the Zotero API, e.g. of a self-hosted dataserver
+	APIURL string
+	// URL of the HTTP proxy for the Zotero API
+	Proxy string
+	// File with additional PEM certificates to trust
+	CABundle  string
+	UserAgent string
+	// Time limit for each request to the Zotero API, e.g. "30s"
+	Timeout Duration
+	// Base directory of the linked files with a relative path, as set in the
+	// Zotero preferences
+	LinkedBaseDir string `json:"linked_base_dir"`
+}
+
+// Duration is a time.Duration written as a string, e.g. "1m30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// ZoteroOptions are the options of the Zotero API client
+func (c *Config) ZoteroOptions() zotero.Options {
+	return zotero.Options{
+		MaxAttempts: c.MaxAttempts,
+		Timeout:     time.Duration(c.Timeout),
+		URL:         c.APIURL,
+		Proxy:       c.Proxy,
+		CABundle:    c.CABundle,
+		UserAgent:   c.UserAgent,
+	}
+}
+
+// WebDAV configures the server where Zotero stores the attachments files,
+// when not using Zotero Storage
+type WebDAV struct {
+	// URL of the zotero folder on the server
+	URL      string
+	Username string
+	// Name of the environment variable holding the password
+	PasswordEnv string
+	// Command that prints the password, e.g. "pass show zotero/webdav"
+	PasswordCmd string
+}
+
+// Password reads the WebDAV password from the configured source
+func (w *WebDAV) Password() (string, error) {
+	if w.PasswordCmd != "" {
+		args, err := shellwords.Parse(w.PasswordCmd)
+		if err != nil {
+			return "", err
+		}
+		if len(args) == 0 {
+			return "", ErrConfigEmptyPasswordCmd
+		}
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	if w.PasswordEnv != "" {
+		return os.Getenv(w.PasswordEnv), nil
+	}
+	return "", nil
 }
 
 const (
@@ -29,6 +112,9 @@ var (
 	ErrConfigEmptyKey     = errors.New("key " + configEmptyMsg)
 	ErrConfigEmptyZotero  = errors.New("zotero " + configEmptyMsg)
 	ErrConfigEmptyStorage = errors.New("storage " + configEmptyMsg)
+	ErrConfigEmptyWebDAV  = errors.New("webdav.url " + configEmptyMsg)
+
+	ErrConfigEmptyPasswordCmd = errors.New("webdav.passwordCmd " + configEmptyMsg)
 )
 
 type ErrConfig struct {
@@ -77,6 +163,9 @@ func loadConfigReader(r io.Reader) (config Config, err error) {
 	if config.Storage == "" {
 		ec.errors = append(ec.errors, ErrConfigEmptyStorage)
 	}
+	if config.WebDAV != nil && config.WebDAV.URL == "" {
+		ec.errors = append(ec.errors, ErrConfigEmptyWebDAV)
+	}
 	if len(ec.errors) > 0 {
 		err = ec
 	}
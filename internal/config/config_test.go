@@ -7,9 +7,12 @@ package config
 import (
 	"bytes"
 	"errors"
+	"os"
 	"testing"
 	"testing/iotest"
+	"time"
 
+	"github.com/acidghost/zotools/internal/zotero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,6 +32,53 @@ func TestLoadConfig(t *testing.T) {
 		assert.Equal(t, c.Storage, "storage.json")
 		assert.Equal(t, c.Zotero, "zotero")
 	})
+	t.Run("Valid WebDAV", func(t *testing.T) {
+		jsonRaw := `{"key": "k", "storage": "s", "zotero": "z",
+			"webdav": {"url": "https://dav.example.com/zotero", "username": "user", "passwordEnv": "PASS"}}`
+		c, err := loadConfigReader(bytes.NewReader([]byte(jsonRaw)))
+		require.NoError(t, err)
+		require.NotNil(t, c.WebDAV)
+		assert.Equal(t, "https://dav.example.com/zotero", c.WebDAV.URL)
+		assert.Equal(t, "user", c.WebDAV.Username)
+		assert.Equal(t, "PASS", c.WebDAV.PasswordEnv)
+	})
+	t.Run("Valid max attempts", func(t *testing.T) {
+		jsonRaw := `{"key": "k", "storage": "s", "zotero": "z", "maxAttempts": 10}`
+		c, err := loadConfigReader(bytes.NewReader([]byte(jsonRaw)))
+		require.NoError(t, err)
+		assert.Equal(t, uint(10), c.MaxAttempts)
+	})
+	t.Run("Valid Zotero API options", func(t *testing.T) {
+		jsonRaw := `{"key": "k", "storage": "s", "zotero": "z", "apiURL": "http://localhost:8080",
+			"proxy": "http://proxy:3128", "caBundle": "ca.pem", "userAgent": "ua", "timeout": "30s"}`
+		c, err := loadConfigReader(bytes.NewReader([]byte(jsonRaw)))
+		require.NoError(t, err)
+		assert.Equal(t, zotero.Options{
+			URL:       "http://localhost:8080",
+			Proxy:     "http://proxy:3128",
+			CABundle:  "ca.pem",
+			UserAgent: "ua",
+			Timeout:   30 * time.Second,
+		}, c.ZoteroOptions())
+	})
+	t.Run("Valid linked base dir", func(t *testing.T) {
+		jsonRaw := `{"key": "k", "storage": "s", "zotero": "z", "linked_base_dir": "/home/me/papers"}`
+		c, err := loadConfigReader(bytes.NewReader([]byte(jsonRaw)))
+		require.NoError(t, err)
+		assert.Equal(t, "/home/me/papers", c.LinkedBaseDir)
+	})
+	t.Run("Invalid timeout", func(t *testing.T) {
+		jsonRaw := `{"key": "k", "storage": "s", "zotero": "z", "timeout": "soon"}`
+		_, err := loadConfigReader(bytes.NewReader([]byte(jsonRaw)))
+		assert.Error(t, err)
+	})
+	t.Run("Empty WebDAV URL", func(t *testing.T) {
+		jsonRaw := `{"key": "k", "storage": "s", "zotero": "z", "webdav": {}}`
+		_, err := loadConfigReader(bytes.NewReader([]byte(jsonRaw)))
+		var ec *ErrConfig
+		require.ErrorAs(t, err, &ec)
+		assert.Equal(t, []error{ErrConfigEmptyWebDAV}, ec.errors)
+	})
 	t.Run("Read error", func(t *testing.T) {
 		expErr := errors.New("some reader error")
 		r := iotest.ErrReader(expErr)
@@ -69,3 +119,25 @@ func TestLoadConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestWebDAVPassword(t *testing.T) {
+	t.Run("From command", func(t *testing.T) {
+		w := WebDAV{PasswordCmd: "echo 'secret pass'", PasswordEnv: "UNUSED"}
+		p, err := w.Password()
+		require.NoError(t, err)
+		assert.Equal(t, "secret pass", p)
+	})
+	t.Run("From environment", func(t *testing.T) {
+		os.Setenv("ZOTOOLS_TEST_PASSWORD", "secret")
+		defer os.Unsetenv("ZOTOOLS_TEST_PASSWORD")
+		w := WebDAV{PasswordEnv: "ZOTOOLS_TEST_PASSWORD"}
+		p, err := w.Password()
+		require.NoError(t, err)
+		assert.Equal(t, "secret", p)
+	})
+	t.Run("Failing command", func(t *testing.T) {
+		w := WebDAV{PasswordCmd: "false"}
+		_, err := w.Password()
+		assert.Error(t, err)
+	})
+}
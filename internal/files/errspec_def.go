@@ -0,0 +1,184 @@
+// Errors generated by Gorror; DO NOT EDIT.
+
+package files
+
+import (
+	"errors"
+	"fmt"
+)
+
+type _errWrap struct{ cause error }
+
+func (w *_errWrap) Unwrap() error { return w.cause }
+
+func (e errSpec) IsIn(err error) bool {
+	var ei interface {
+		Is(errSpec) bool
+		Unwrap() error
+	}
+	if errors.As(err, &ei) {
+		if ei.Is(e) {
+			return true
+		}
+		return e.IsIn(ei.Unwrap())
+	}
+	return false
+}
+
+type errDownload struct {
+	_errWrap
+	key string
+}
+
+func newErrDownload(key string, err error) *errDownload {
+	return &errDownload{_errWrap{err}, key}
+}
+
+func (e *errDownload) Error() string {
+	return fmt.Sprintf("failed to download %s: %v", e.key, e.cause)
+}
+
+func (e *errDownload) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*errDownload) Is(e errSpec) bool { return e == errDownloadSpec }
+
+type errWrite struct {
+	_errWrap
+	path string
+}
+
+func newErrWrite(path string, err error) *errWrite {
+	return &errWrite{_errWrap{err}, path}
+}
+
+func (e *errWrite) Error() string {
+	return fmt.Sprintf("failed to write %q: %v", e.path, e.cause)
+}
+
+func (e *errWrite) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*errWrite) Is(e errSpec) bool { return e == errWriteSpec }
+
+type errChecksum struct {
+	path string
+	got  string
+	exp  string
+}
+
+func newErrChecksum(path string, got string, exp string) *errChecksum {
+	return &errChecksum{path, got, exp}
+}
+
+func (e *errChecksum) Error() string {
+	return fmt.Sprintf("checksum of %q is %s instead of %s", e.path, e.got, e.exp)
+}
+
+func (*errChecksum) Is(e errSpec) bool { return e == errChecksumSpec }
+
+type errPassword struct {
+	_errWrap
+}
+
+func newErrPassword(err error) *errPassword {
+	return &errPassword{_errWrap{err}}
+}
+
+func (e *errPassword) Error() string {
+	return fmt.Sprintf("failed to read the WebDAV password: %v", e.cause)
+}
+
+func (e *errPassword) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*errPassword) Is(e errSpec) bool { return e == errPasswordSpec }
+
+type errStatus struct {
+	status int
+	url    string
+}
+
+func newErrStatus(status int, url string) *errStatus {
+	return &errStatus{status, url}
+}
+
+func (e *errStatus) Error() string {
+	return fmt.Sprintf("received %d status code from %s", e.status, e.url)
+}
+
+func (*errStatus) Is(e errSpec) bool { return e == errStatusSpec }
+
+type errProp struct {
+	_errWrap
+	key string
+}
+
+func newErrProp(key string, err error) *errProp {
+	return &errProp{_errWrap{err}, key}
+}
+
+func (e *errProp) Error() string {
+	return fmt.Sprintf("failed to parse the properties of %s: %v", e.key, e.cause)
+}
+
+func (e *errProp) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*errProp) Is(e errSpec) bool { return e == errPropSpec }
+
+type errUnzip struct {
+	_errWrap
+	key string
+}
+
+func newErrUnzip(key string, err error) *errUnzip {
+	return &errUnzip{_errWrap{err}, key}
+}
+
+func (e *errUnzip) Error() string {
+	return fmt.Sprintf("failed to unpack %s: %v", e.key, e.cause)
+}
+
+func (e *errUnzip) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*errUnzip) Is(e errSpec) bool { return e == errUnzipSpec }
+
+type errUnsafe struct {
+	name string
+}
+
+func newErrUnsafe(name string) *errUnsafe {
+	return &errUnsafe{name}
+}
+
+func (e *errUnsafe) Error() string {
+	return fmt.Sprintf("unsafe path %q in archive", e.name)
+}
+
+func (*errUnsafe) Is(e errSpec) bool { return e == errUnsafeSpec }
+
+type errBaseDir struct {
+	path string
+}
+
+func newErrBaseDir(path string) *errBaseDir {
+	return &errBaseDir{path}
+}
+
+func (e *errBaseDir) Error() string {
+	return fmt.Sprintf("linked_base_dir is not configured to resolve %q", e.path)
+}
+
+func (*errBaseDir) Is(e errSpec) bool { return e == errBaseDirSpec }
@@ -0,0 +1,179 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package files
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/zotero"
+)
+
+// Source provides the content of the attachments files
+type Source interface {
+	FileContext(ctx context.Context, lib zotero.Library, key string) (io.ReadCloser, error)
+}
+
+// File is an attachment file that is expected under the Zotero data directory,
+// unless it is linked
+type File struct {
+	Library  zotero.Library
+	Key      string
+	Filename string
+	MD5      string
+	// Modification time in milliseconds since the epoch
+	MTime    int64
+	LinkMode string
+	// Path of linked files, possibly relative to the base directory
+	Path string
+	// Address of linked URLs
+	URL string
+}
+
+// Fetcher makes the attachments files available in the Zotero data directory
+type Fetcher interface {
+	// Fetch makes sure that the file is present and up to date, downloading
+	// it when needed until ctx is done, and returns its path; linked files
+	// cannot be fetched
+	Fetch(ctx context.Context, file File) (string, error)
+}
+
+// API downloads the attachments files from Zotero Storage
+type API struct {
+	src Source
+	dir string
+}
+
+type errSpec string
+
+const (
+	errDownloadSpec = errSpec("wrap:failed to download {{key string %s}}")
+	errWriteSpec    = errSpec("wrap:failed to write {{path string %q}}")
+	errChecksumSpec = errSpec("nowrap:checksum of {{path string %q}} is {{got string %s}} instead of {{exp string %s}}")
+	errPasswordSpec = errSpec("wrap:failed to read the WebDAV password")
+	errStatusSpec   = errSpec("nowrap:received {{status int %d}} status code from {{url string %s}}")
+	errPropSpec     = errSpec("wrap:failed to parse the properties of {{key string %s}}")
+	errUnzipSpec    = errSpec("wrap:failed to unpack {{key string %s}}")
+	errUnsafeSpec   = errSpec("nowrap:unsafe path {{name string %q}} in archive")
+	errBaseDirSpec  = errSpec("nowrap:linked_base_dir is not configured to resolve {{path string %q}}")
+)
+
+//go:generate gorror -type=errSpec -suffix=Spec
+
+func NewAPI(src Source, zoteroDir string) *API {
+	return &API{src, zoteroDir}
+}
+
+// FromConfig returns the fetcher for the WebDAV server if configured,
+// otherwise the one for Zotero Storage
+func FromConfig(ctx context.Context, conf config.Config) (Fetcher, error) {
+	if conf.WebDAV != nil {
+		password, err := conf.WebDAV.Password()
+		if err != nil {
+			return nil, newErrPassword(err)
+		}
+		return NewWebDAV(conf.WebDAV.URL, conf.WebDAV.Username, password, conf.Zotero), nil
+	}
+	zot, err := zotero.NewContext(ctx, conf.Key, conf.ZoteroOptions())
+	if err != nil {
+		return nil, err
+	}
+	return NewAPI(zot, conf.Zotero), nil
+}
+
+func (f *API) Fetch(ctx context.Context, file File) (string, error) {
+	path := storedPath(file, f.dir)
+	if upToDate(path, file) {
+		return path, nil
+	}
+
+	content, err := f.src.FileContext(ctx, file.Library, file.Key)
+	if err != nil {
+		return path, newErrDownload(file.Key, err)
+	}
+	defer content.Close()
+
+	if err := writeFile(path, content, file); err != nil {
+		return path, err
+	}
+
+	return path, nil
+}
+
+// upToDate checks whether the file at path exists and matches the expected
+// modification time or, failing that, the expected checksum
+func upToDate(path string, file File) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if file.MTime != 0 && info.ModTime().UnixNano()/int64(time.Millisecond) == file.MTime {
+		return true
+	}
+	if file.MD5 == "" {
+		return true
+	}
+	sum, err := md5File(path)
+	return err == nil && sum == file.MD5
+}
+
+func md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeFile stores content at path, through a temporary file so that a
+// failed download never leaves a broken attachment behind
+func writeFile(path string, content io.Reader, file File) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return newErrWrite(path, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".zotools-*")
+	if err != nil {
+		return newErrWrite(path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newErrWrite(path, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); file.MD5 != "" && sum != file.MD5 {
+		return newErrChecksum(path, sum, file.MD5)
+	}
+
+	if file.MTime != 0 {
+		mtime := time.Unix(0, file.MTime*int64(time.Millisecond))
+		if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+			return newErrWrite(path, err)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return newErrWrite(path, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package files
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	content  string
+	err      error
+	requests int
+}
+
+func (s *fakeSource) FileContext(_ context.Context, _ zotero.Library, _ string) (io.ReadCloser, error) {
+	s.requests++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return io.NopCloser(strings.NewReader(s.content)), nil
+}
+
+func md5String(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFetch(t *testing.T) {
+	const content = "%PDF-1.5"
+	mtime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	file := File{
+		Key:      "A1",
+		Filename: "paper.pdf",
+		MD5:      md5String(content),
+		MTime:    mtime.UnixNano() / int64(time.Millisecond),
+	}
+
+	t.Run("Download missing", func(t *testing.T) {
+		src := &fakeSource{content: content}
+		path, err := NewAPI(src, t.TempDir()).Fetch(context.Background(), file)
+		require.NoError(t, err)
+		bs, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(bs))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(mtime))
+	})
+	t.Run("Skip up to date", func(t *testing.T) {
+		src := &fakeSource{content: content}
+		fetcher := NewAPI(src, t.TempDir())
+		_, err := fetcher.Fetch(context.Background(), file)
+		require.NoError(t, err)
+		_, err = fetcher.Fetch(context.Background(), file)
+		require.NoError(t, err)
+		assert.Equal(t, 1, src.requests)
+	})
+	t.Run("Checksum mismatch", func(t *testing.T) {
+		src := &fakeSource{content: "corrupted"}
+		path, err := NewAPI(src, t.TempDir()).Fetch(context.Background(), file)
+		var e *errChecksum
+		assert.ErrorAs(t, err, &e)
+		assert.NoFileExists(t, path)
+	})
+	t.Run("Download error", func(t *testing.T) {
+		src := &fakeSource{err: errors.New("not found")}
+		_, err := NewAPI(src, t.TempDir()).Fetch(context.Background(), file)
+		var e *errDownload
+		assert.ErrorAs(t, err, &e)
+	})
+}
@@ -0,0 +1,90 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package files
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/zotero"
+)
+
+// Link modes of the attachments, an empty one is taken as ImportedFile
+const (
+	ImportedFile = "imported_file"
+	ImportedURL  = "imported_url"
+	LinkedFile   = "linked_file"
+	LinkedURL    = "linked_url"
+)
+
+// Prefix of the paths of linked files relative to the base directory
+const relativePrefix = "attachments:"
+
+// Main file of the HTML snapshots stored without a filename
+const snapshotIndex = "index.html"
+
+// FromAttachment describes the file of a stored attachment of lib
+func FromAttachment(lib zotero.Library, attach *storage.Attachment) File {
+	return File{
+		Library:  lib,
+		Key:      attach.Key,
+		Filename: attach.Filename,
+		MD5:      attach.MD5,
+		MTime:    attach.MTime,
+		LinkMode: attach.LinkMode,
+		Path:     attach.Path,
+		URL:      attach.URL,
+	}
+}
+
+// FromSearchResult describes the file of a search result
+func FromSearchResult(item *storage.SearchResultsItem) File {
+	return File{
+		Library:  item.Library,
+		Key:      item.Key,
+		Filename: item.Filename,
+		MD5:      item.MD5,
+		MTime:    item.MTime,
+		LinkMode: item.LinkMode,
+		Path:     item.Path,
+		URL:      item.URL,
+	}
+}
+
+// Stored tells whether the file is kept by Zotero, and so can be fetched
+func (f *File) Stored() bool {
+	return f.LinkMode != LinkedFile && f.LinkMode != LinkedURL
+}
+
+// Location is the URL of a linked URL, otherwise the path of the file: for
+// linked files the one they were linked from, resolving the paths relative to
+// linkedBaseDir, and for the others the one in zoteroDir.
+func Location(file File, zoteroDir, linkedBaseDir string) (string, error) {
+	switch file.LinkMode {
+	case LinkedURL:
+		return file.URL, nil
+	case LinkedFile:
+		if !strings.HasPrefix(file.Path, relativePrefix) {
+			return file.Path, nil
+		}
+		if linkedBaseDir == "" {
+			return "", newErrBaseDir(file.Path)
+		}
+		rel := filepath.FromSlash(strings.TrimPrefix(file.Path, relativePrefix))
+		return filepath.Join(linkedBaseDir, rel), nil
+	}
+	return storedPath(file, zoteroDir), nil
+}
+
+// storedPath is where Zotero keeps the file in zoteroDir
+func storedPath(file File, zoteroDir string) string {
+	name := file.Filename
+	if name == "" && file.LinkMode == ImportedURL {
+		name = snapshotIndex
+	}
+	return utils.MakePath(zoteroDir, file.Key, name)
+}
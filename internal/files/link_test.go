@@ -0,0 +1,52 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package files
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocation(t *testing.T) {
+	zoteroDir, baseDir := filepath.FromSlash("/zotero"), filepath.FromSlash("/papers")
+	tests := []struct {
+		name string
+		file File
+		exp  string
+	}{
+		{"Imported", File{Key: "A1", Filename: "a.pdf"}, filepath.FromSlash("/zotero/storage/A1/a.pdf")},
+		{"Imported file", File{Key: "A1", Filename: "a.pdf", LinkMode: ImportedFile},
+			filepath.FromSlash("/zotero/storage/A1/a.pdf")},
+		{"Snapshot", File{Key: "A1", Filename: "page.html", LinkMode: ImportedURL},
+			filepath.FromSlash("/zotero/storage/A1/page.html")},
+		{"Snapshot without filename", File{Key: "A1", LinkMode: ImportedURL},
+			filepath.FromSlash("/zotero/storage/A1/index.html")},
+		{"Linked file", File{Key: "A1", LinkMode: LinkedFile, Path: "/home/me/a.pdf"}, "/home/me/a.pdf"},
+		{"Relative linked file", File{Key: "A1", LinkMode: LinkedFile, Path: "attachments:sub/a.pdf"},
+			filepath.FromSlash("/papers/sub/a.pdf")},
+		{"Linked URL", File{Key: "A1", LinkMode: LinkedURL, URL: "https://example.com"}, "https://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := Location(tt.file, zoteroDir, baseDir)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, path)
+		})
+	}
+
+	_, err := Location(File{LinkMode: LinkedFile, Path: "attachments:a.pdf"}, zoteroDir, "")
+	var e *errBaseDir
+	assert.ErrorAs(t, err, &e)
+}
+
+func TestStored(t *testing.T) {
+	assert.True(t, (&File{}).Stored())
+	assert.True(t, (&File{LinkMode: ImportedURL}).Stored())
+	assert.False(t, (&File{LinkMode: LinkedFile}).Stored())
+	assert.False(t, (&File{LinkMode: LinkedURL}).Stored())
+}
@@ -0,0 +1,158 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package files
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/acidghost/zotools/internal/utils"
+)
+
+// WebDAV downloads the attachments files from a WebDAV server, where Zotero
+// keeps each of them as <key>.zip along with its properties in <key>.prop
+type WebDAV struct {
+	url      string
+	username string
+	password string
+	dir      string
+	client   http.Client
+}
+
+// properties is the content of a .prop file
+type properties struct {
+	MTime int64  `xml:"mtime"`
+	Hash  string `xml:"hash"`
+}
+
+func NewWebDAV(url, username, password, zoteroDir string) *WebDAV {
+	var client http.Client
+	return &WebDAV{strings.TrimSuffix(url, "/"), username, password, zoteroDir, client}
+}
+
+func (w *WebDAV) Fetch(ctx context.Context, file File) (string, error) {
+	path := storedPath(file, w.dir)
+	if upToDate(path, file) {
+		return path, nil
+	}
+
+	props, err := w.properties(ctx, file.Key)
+	if err != nil {
+		return path, err
+	}
+
+	archive, err := w.download(ctx, file.Key)
+	if err != nil {
+		return path, err
+	}
+	defer os.Remove(archive)
+
+	// The checksum and modification time of the WebDAV copy are the ones to
+	// verify, the library might be ahead of the files
+	file.MD5, file.MTime = props.Hash, props.MTime
+	if err := w.unpack(archive, file); err != nil {
+		return path, err
+	}
+
+	return path, nil
+}
+
+func (w *WebDAV) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(w.username, w.password)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, newErrStatus(resp.StatusCode, url)
+	}
+	return resp, nil
+}
+
+func (w *WebDAV) properties(ctx context.Context, key string) (*properties, error) {
+	resp, err := w.get(ctx, w.url+"/"+key+".prop")
+	if err != nil {
+		return nil, newErrDownload(key, err)
+	}
+	defer resp.Body.Close()
+
+	var props properties
+	if err := xml.NewDecoder(resp.Body).Decode(&props); err != nil {
+		return nil, newErrProp(key, err)
+	}
+	return &props, nil
+}
+
+// download stores the archive of the attachment in a temporary file, since
+// unpacking needs random access to it
+func (w *WebDAV) download(ctx context.Context, key string) (string, error) {
+	resp, err := w.get(ctx, w.url+"/"+key+".zip")
+	if err != nil {
+		return "", newErrDownload(key, err)
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp("", "zotools-*.zip")
+	if err != nil {
+		return "", newErrDownload(key, err)
+	}
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", newErrDownload(key, err)
+	}
+	return tmp.Name(), nil
+}
+
+// unpack extracts all the files in the archive into the folder of the
+// attachment, checking the main file against the expected properties
+func (w *WebDAV) unpack(archive string, file File) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return newErrUnzip(file.Key, err)
+	}
+	defer r.Close()
+
+	base := utils.MakePath(w.dir, file.Key, "")
+	for _, entry := range r.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		path := filepath.Join(base, entry.Name)
+		if !strings.HasPrefix(path, base+string(filepath.Separator)) {
+			return newErrUnsafe(entry.Name)
+		}
+
+		expected := File{Key: file.Key}
+		if entry.Name == file.Filename {
+			expected = file
+		}
+
+		content, err := entry.Open()
+		if err != nil {
+			return newErrUnzip(file.Key, err)
+		}
+		err = writeFile(path, content, expected)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
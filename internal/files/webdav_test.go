@@ -0,0 +1,124 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const propFmt = `<properties version="1"><mtime>%d</mtime><hash>%s</hash></properties>`
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+// webDAVServer stands in for a WebDAV server holding the given files
+func webDAVServer(t *testing.T, files map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		content, exists := files[r.URL.Path]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(content)
+	}))
+}
+
+func TestWebDAVFetch(t *testing.T) {
+	const content = "%PDF-1.5"
+	mtime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	mtimeMs := mtime.UnixNano() / int64(time.Millisecond)
+	file := File{Key: "A1", Filename: "paper.pdf"}
+	archive := makeZip(t, map[string]string{"paper.pdf": content, "extra/image.png": "png"})
+
+	t.Run("Successful", func(t *testing.T) {
+		ts := webDAVServer(t, map[string][]byte{
+			"/zotero/A1.prop": []byte(fmt.Sprintf(propFmt, mtimeMs, md5String(content))),
+			"/zotero/A1.zip":  archive,
+		})
+		defer ts.Close()
+		dir := t.TempDir()
+		path, err := NewWebDAV(ts.URL+"/zotero/", "user", "pass", dir).Fetch(context.Background(), file)
+		require.NoError(t, err)
+		bs, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(bs))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(mtime))
+		assert.FileExists(t, utils.MakePath(dir, "A1", "extra/image.png"))
+	})
+	t.Run("Hash mismatch", func(t *testing.T) {
+		ts := webDAVServer(t, map[string][]byte{
+			"/zotero/A1.prop": []byte(fmt.Sprintf(propFmt, mtimeMs, md5String("other"))),
+			"/zotero/A1.zip":  archive,
+		})
+		defer ts.Close()
+		path, err := NewWebDAV(ts.URL+"/zotero", "user", "pass", t.TempDir()).Fetch(context.Background(), file)
+		var e *errChecksum
+		assert.ErrorAs(t, err, &e)
+		assert.NoFileExists(t, path)
+	})
+	t.Run("Wrong credentials", func(t *testing.T) {
+		ts := webDAVServer(t, map[string][]byte{})
+		defer ts.Close()
+		_, err := NewWebDAV(ts.URL+"/zotero", "user", "wrong", t.TempDir()).Fetch(context.Background(), file)
+		var e *errStatus
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, http.StatusUnauthorized, e.status)
+	})
+	t.Run("Invalid properties", func(t *testing.T) {
+		ts := webDAVServer(t, map[string][]byte{"/zotero/A1.prop": []byte("<properties")})
+		defer ts.Close()
+		_, err := NewWebDAV(ts.URL+"/zotero", "user", "pass", t.TempDir()).Fetch(context.Background(), file)
+		var e *errProp
+		assert.ErrorAs(t, err, &e)
+	})
+	t.Run("Unsafe archive", func(t *testing.T) {
+		ts := webDAVServer(t, map[string][]byte{
+			"/zotero/A1.prop": []byte(fmt.Sprintf(propFmt, mtimeMs, md5String(content))),
+			"/zotero/A1.zip":  makeZip(t, map[string]string{"../../evil": "x"}),
+		})
+		defer ts.Close()
+		_, err := NewWebDAV(ts.URL+"/zotero", "user", "pass", t.TempDir()).Fetch(context.Background(), file)
+		var e *errUnsafe
+		assert.ErrorAs(t, err, &e)
+	})
+	t.Run("Cancelled", func(t *testing.T) {
+		ts := webDAVServer(t, map[string][]byte{})
+		defer ts.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewWebDAV(ts.URL+"/zotero", "user", "pass", t.TempDir()).Fetch(ctx, file)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
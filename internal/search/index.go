@@ -0,0 +1,126 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package search
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/storage"
+)
+
+// indexScopes returns where the search looks, or nil when the index does not
+// cover all of it
+func (c *Command) indexScopes() []storage.IndexScope {
+	if *c.flagNotes || *c.flagFulltext || len(*c.flagFields) > 0 {
+		return nil
+	}
+	scopes := []storage.IndexScope{storage.TitleScope}
+	if *c.flagAbstract {
+		scopes = append(scopes, storage.AbstractScope)
+	}
+	if *c.flagAuthors {
+		scopes = append(scopes, storage.AuthorsScope)
+	}
+	return scopes
+}
+
+// loadIndex loads the index built by sync, nil if missing as then all the
+// items are checked
+func loadIndex(conf config.Config) *storage.IndexData {
+	index := storage.NewIndex(storage.IndexFilename(conf.Storage))
+	if err := index.Load(); err != nil {
+		return nil
+	}
+	return &index.Data
+}
+
+// requiredTrigrams returns trigrams that any text matching expr contains,
+// lowercase and simplified, or none if it cannot tell
+func requiredTrigrams(expr string) []string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	trigrams := []string{}
+	for _, literal := range requiredLiterals(re.Simplify()) {
+		for _, trigram := range storage.Trigrams(strings.ToLower(literal)) {
+			// The simplified text has no accents, and the case folding of
+			// the other characters may differ from the index one
+			if !seen[trigram] && isASCII(trigram) {
+				seen[trigram] = true
+				trigrams = append(trigrams, trigram)
+			}
+		}
+	}
+	return trigrams
+}
+
+// requiredLiterals returns strings that any match of re contains
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// Consecutive literals are joined, e.g. x{2}yz requires xxyz
+		var literals []string
+		run := ""
+		for _, sub := range re.Sub {
+			if exact, ok := exactString(sub); ok {
+				run += exact
+				continue
+			}
+			if run != "" {
+				literals = append(literals, run)
+				run = ""
+			}
+			literals = append(literals, requiredLiterals(sub)...)
+		}
+		if run != "" {
+			literals = append(literals, run)
+		}
+		return literals
+	}
+	return nil
+}
+
+// exactString returns the only string re matches, if so
+func exactString(re *syntax.Regexp) (string, bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune), true
+	case syntax.OpCapture:
+		return exactString(re.Sub[0])
+	case syntax.OpConcat:
+		var exact strings.Builder
+		for _, sub := range re.Sub {
+			s, ok := exactString(sub)
+			if !ok {
+				return "", false
+			}
+			exact.WriteString(s)
+		}
+		return exact.String(), true
+	}
+	return "", false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
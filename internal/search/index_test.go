@@ -0,0 +1,58 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package search
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredTrigrams(t *testing.T) {
+	tests := []struct {
+		expr string
+		exp  []string
+	}{
+		{"(?i)Bach", []string{"bac", "ach"}},
+		{"gö?del", []string{"del"}},
+		{"^quantum.*(field|string)s+", []string{"qua", "uan", "ant", "ntu", "tum"}},
+		{"(?:abc)+x{2}yz", []string{"abc", "xxy", "xyz"}},
+		{"a|bcd", []string{}},
+		{"é", []string{}},
+		{"[a-z]+", []string{}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, requiredTrigrams(tt.expr), tt.expr)
+	}
+}
+
+func TestIndexCandidates(t *testing.T) {
+	lib := storage.Library{Items: []storage.Item{
+		{Key: "A1", Title: "Quantum Field Theory"},
+		{Key: "A2", Title: "Théorie des cordes"},
+		{Key: "A3", Title: "Classical mechanics"},
+	}}
+	tr := storage.NewSimplifier()
+	for i := range lib.Items {
+		lib.Items[i].Fold(tr)
+	}
+	idx := storage.BuildIndex(&lib)
+	exprs := []string{"(?i)theor", "(?i)field th", "(?i)CORD", "mech", "(?i)quantum\\s+field"}
+	for _, expr := range exprs {
+		// The candidates include all the matching items
+		re := regexp.MustCompile(expr)
+		m := newMatcher(re)
+		m.folded = true
+		candidates := idx.Candidates(requiredTrigrams(expr), storage.TitleScope)
+		for _, item := range lib.Items {
+			if m.matchFolded(item.Title, item.Folded.Title) {
+				assert.True(t, candidates[item.Key], "%s in %s", expr, item.Key)
+			}
+		}
+		assert.NotEmpty(t, candidates, expr)
+	}
+}
@@ -11,16 +11,15 @@ import (
 	"runtime"
 	"strings"
 	"sync"
-	"unicode"
+	"unicode/utf8"
 
 	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/files"
 	"github.com/acidghost/zotools/internal/storage"
 	"github.com/acidghost/zotools/internal/utils"
 	"github.com/acidghost/zotools/internal/zotero"
 	"github.com/fatih/color"
-	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
 )
 
 const searchUsageTop = " " + utils.OptionsUsage + " search-regexp"
@@ -35,25 +34,55 @@ var (
 	titleColor  = color.New(color.FgGreen, color.Bold)
 	selColor    = color.New(color.FgMagenta)
 	attachColor = color.New(color.FgBlue)
+	snipColor   = color.New(color.FgYellow)
+	fieldColor  = color.New(color.FgCyan)
 )
 
+// Number of characters shown around a match in a snippet
+const snippetContext = 40
+
+// Type of the standalone attachments, that also match by filename
+const attachmentType = "attachment"
+
 type Command struct {
 	fs           *flag.FlagSet
 	flagAbstract *bool
 	flagAuthors  *bool
 	flagSens     *bool
 	flagPar      *uint
+	flagLib      *string
+	flagColl     *string
+	flagSubColl  *bool
+	flagTags     *utils.StringsFlag
+	flagNotes    *bool
+	flagFulltext *bool
+	flagFields   *utils.StringsFlag
+	flagShow     *utils.StringsFlag
+	// Text of the attachments, loaded only for full-text searches
+	fulltext *storage.FulltextData
 }
 
 func New(cmd, banner string) *Command {
 	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
 	flagAbstract := fs.Bool("abs", false, "search also in the abstract")
 	flagAuthors := fs.Bool("auth", false, "search also among the authors")
+	flagNotes := fs.Bool("notes", false, "search also in the notes")
+	flagFulltext := fs.Bool("fulltext", false, "search also in the full-text of the attachments")
 	flagSens := fs.Bool("s", false, "regular expression is case sensitive")
 	flagPar := fs.Uint("j", uint(numCPU),
 		fmt.Sprintf("number of search jobs (between 1 and %d)", numCPU))
+	flagLib := fs.String("lib", "", "search only in the library with this name or ID")
+	flagColl := fs.String("coll", "", "search only in the collection with this name or path (e.g. A/B)")
+	flagSubColl := fs.Bool("subcoll", false, "search also in the subcollections of -coll")
+	flagTags := &utils.StringsFlag{}
+	fs.Var(flagTags, "tag", "search only items with this tag (repeat to require more, prefix with ! to exclude)")
+	flagFields := &utils.StringsFlag{}
+	fs.Var(flagFields, "field", "search also in this metadata field, e.g. DOI (can be repeated)")
+	flagShow := &utils.StringsFlag{}
+	fs.Var(flagShow, "show", "show this metadata field of the results, e.g. date (can be repeated)")
 	fs.Usage = utils.MakeUsage(fs, cmd, banner, searchUsageTop, searchUsageBottom)
-	return &Command{fs, flagAbstract, flagAuthors, flagSens, flagPar}
+	return &Command{fs, flagAbstract, flagAuthors, flagSens, flagPar, flagLib, flagColl,
+		flagSubColl, flagTags, flagNotes, flagFulltext, flagFields, flagShow, nil}
 }
 
 func (c *Command) Run(args []string, conf config.Config) {
@@ -82,26 +111,47 @@ func (c *Command) Run(args []string, conf config.Config) {
 		utils.Die("Wrong search: %v\n", err)
 	}
 
-	store := storage.New(conf.Storage)
+	store, err := storage.FromConfig(conf)
+	if err != nil {
+		utils.Die("Failed to open the local storage:\n - %v\n", err)
+	}
 	if err := store.Load(); err != nil {
 		utils.Die("Failed to load the local storage:\n - %v\n", err)
 	}
+	for i := range store.Data.Libs {
+		if store.Data.Libs[i].NeedsResync() {
+			utils.Eprintf("Warning: library %q is outdated, run `zotools sync` to complete it\n",
+				store.Data.Libs[i].Name)
+		}
+	}
 
-	fmt.Printf("Loaded storage, version %d, %d items\n",
-		store.Data.Lib.Version, len(store.Data.Lib.Items))
+	fmt.Printf("Loaded storage, %d libraries, %d items\n",
+		len(store.Data.Libs), store.Data.NumItems())
+
+	if *c.flagFulltext {
+		fulltext := storage.NewFulltext(storage.FulltextFilename(conf.Storage))
+		if err := fulltext.Load(); err != nil {
+			utils.Die("Failed to load the full-text storage (try sync -fulltext):\n - %v\n", err)
+		}
+		c.fulltext = &fulltext.Data
+	}
 
 	wgMatchers := sync.WaitGroup{}
-	itemsCh := make(chan storage.Item)
-	matchedCh := make(chan storage.Item)
+	itemsCh := make(chan libItem)
+	matchedCh := make(chan matched)
 	resCh := make(chan storage.SearchResults)
 
 	// Start matcher jobs
 	for i := 0; i < par; i++ {
 		go func() {
 			s := newMatcher(re)
-			for item := range itemsCh {
-				if c.matchItem(&s, &item) {
-					matchedCh <- item
+			s.folded = !*c.flagSens
+			for li := range itemsCh {
+				item := &li.item
+				notes := c.matchNotes(&s, item)
+				texts := c.matchFulltext(&s, li.lib, item)
+				if c.matchItem(&s, item) || len(notes) > 0 || len(texts) > 0 {
+					matchedCh <- matched{li, notes, texts}
 				}
 			}
 			// No more items to match
@@ -120,21 +170,41 @@ func (c *Command) Run(args []string, conf config.Config) {
 	go func() {
 		res := storage.SearchResults{Term: search, Items: make([]storage.SearchResultsItem, 0, 10)}
 		var i uint
-		for item := range matchedCh {
+		for m := range matchedCh {
+			item := &m.item
 			titleColor.Print(item.Title)
 			if len(item.Creators) > 0 {
 				fmt.Printf(" (%s)\n", authorsToString(item.Creators))
 			} else {
 				fmt.Println()
 			}
-			for _, attach := range item.Attachments {
-				path := utils.MakePath(conf.Zotero, attach.Key, attach.Filename)
+			if fields := showFields(item, *c.flagShow); fields != "" {
+				fmt.Printf("     %s\n", fieldColor.Sprint(fields))
+			}
+			for _, note := range m.notes {
+				fmt.Printf("     %s\n", snipColor.Sprint(note))
+			}
+			for k := range item.Attachments {
+				attach := &item.Attachments[k]
+				path, err := files.Location(files.FromAttachment(m.lib, attach), conf.Zotero, conf.LinkedBaseDir)
+				if err != nil {
+					path = attach.Path
+				}
 				ns := fmt.Sprintf("%3d)", i)
 				fmt.Printf("%s %s\n", selColor.Sprint(ns), attachColor.Sprint(path))
+				if text, ok := m.texts[attach.Key]; ok {
+					fmt.Printf("     %s\n", snipColor.Sprint(text))
+				}
 				res.Items = append(res.Items, storage.SearchResultsItem{
+					Library:     m.lib,
 					Key:         attach.Key,
 					Filename:    attach.Filename,
 					ContentType: attach.ContentType,
+					MD5:         attach.MD5,
+					MTime:       attach.MTime,
+					LinkMode:    attach.LinkMode,
+					Path:        attach.Path,
+					URL:         attach.URL,
 				})
 				i++
 			}
@@ -142,17 +212,46 @@ func (c *Command) Run(args []string, conf config.Config) {
 		resCh <- res
 	}()
 
-	// Send all items to matchers
-	for _, item := range store.Data.Lib.Items {
-		itemsCh <- item
+	// Only the items with all the trigrams of the search can match, the index
+	// tells which ones have them
+	var index *storage.IndexData
+	scopes := c.indexScopes()
+	trigrams := requiredTrigrams(reFlags + search)
+	if scopes != nil && len(trigrams) > 0 {
+		index = loadIndex(conf)
+	}
+
+	// Send all items of the selected libraries and collections to matchers
+	for i := range store.Data.Libs {
+		lib := &store.Data.Libs[i]
+		if !matchLibrary(lib, *c.flagLib) {
+			continue
+		}
+		var colls map[string]bool
+		if *c.flagColl != "" {
+			colls = lib.FindCollections(*c.flagColl, *c.flagSubColl)
+		}
+		var candidates map[string]bool
+		if index != nil {
+			if idx := index.Library(lib); idx != nil {
+				candidates = idx.Candidates(trigrams, scopes...)
+			}
+		}
+		for _, item := range lib.Items {
+			if candidates != nil && !candidates[item.Key] {
+				continue
+			}
+			if (colls == nil || inCollections(&item, colls)) && matchTags(&item, *c.flagTags) {
+				itemsCh <- libItem{lib.Library, item}
+			}
+		}
 	}
 
 	// Close to let the matchers know that we're done with the items
 	close(itemsCh)
 	// Wait for printer to be done
 	res := <-resCh
-	store.Data.Search = &res
-	if err := store.Persist(); err != nil {
+	if err := store.PutSearch(&res); err != nil {
 		utils.Die("Failed to persist search:\n - %v\n", err)
 	}
 
@@ -162,50 +261,199 @@ func (c *Command) Run(args []string, conf config.Config) {
 }
 
 func (c *Command) matchItem(m *matcher, item *storage.Item) bool {
-	match := m.match(item.Title)
+	match := m.matchFolded(item.Title, item.Folded.Title)
 	if *c.flagAbstract {
 		if *c.flagAuthors {
-			match = match || m.match(item.Abstract) || m.matchAuthors(item.Creators)
+			match = match || m.matchFolded(item.Abstract, item.Folded.Abstract) || m.matchAuthors(item)
 		} else {
-			match = match || m.match(item.Abstract)
+			match = match || m.matchFolded(item.Abstract, item.Folded.Abstract)
 		}
 	} else if *c.flagAuthors {
-		match = match || m.matchAuthors(item.Creators)
+		match = match || m.matchAuthors(item)
+	}
+	for _, field := range *c.flagFields {
+		if match {
+			break
+		}
+		match = m.match(item.Field(field))
+	}
+	if item.ItemType == attachmentType {
+		for _, attach := range item.Attachments {
+			if match {
+				break
+			}
+			match = m.match(attach.Filename)
+		}
 	}
 	return match
 }
 
+// showFields formats the given metadata fields of the item, skipping the
+// ones it does not have
+func showFields(item *storage.Item, fields []string) string {
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if value := item.Field(field); value != "" {
+			values = append(values, field+": "+value)
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// matchNotes returns a snippet for each note of the item that matches, if
+// searching in notes is enabled
+func (c *Command) matchNotes(m *matcher, item *storage.Item) []string {
+	if !*c.flagNotes {
+		return nil
+	}
+	var snippets []string
+	for _, note := range item.Notes {
+		if loc := m.find(note.Text); loc != nil {
+			snippets = append(snippets, snippet(note.Text, loc))
+		}
+	}
+	return snippets
+}
+
+// matchFulltext returns a snippet for each attachment of the item whose text
+// matches, by attachment key, if searching in the full-text is enabled
+func (c *Command) matchFulltext(m *matcher, lib zotero.Library, item *storage.Item) map[string]string {
+	if !*c.flagFulltext {
+		return nil
+	}
+	var snippets map[string]string
+	for _, attach := range item.Attachments {
+		text, ok := c.fulltext.Text(lib, attach.Key)
+		if !ok {
+			continue
+		}
+		if loc := m.find(text); loc != nil {
+			if snippets == nil {
+				snippets = make(map[string]string)
+			}
+			snippets[attach.Key] = snippet(text, loc)
+		}
+	}
+	return snippets
+}
+
+// libItem is an item together with the library it belongs to
+type libItem struct {
+	lib  zotero.Library
+	item storage.Item
+}
+
+// matched is an item that matched the search, along with the snippets of
+// its matching notes and attachments text
+type matched struct {
+	libItem
+	notes []string
+	texts map[string]string
+}
+
+// snippet extracts the text surrounding the match at loc, on a single line
+func snippet(text string, loc []int) string {
+	start, end := loc[0]-snippetContext, loc[1]+snippetContext
+	prefix, suffix := "...", "..."
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(text) {
+		end, suffix = len(text), ""
+	}
+	// Do not cut multi-byte characters in half
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	return prefix + strings.Join(strings.Fields(text[start:end]), " ") + suffix
+}
+
+// matchLibrary checks whether lib is selected by the given name or ID; an
+// empty filter selects all the libraries
+func matchLibrary(lib *storage.Library, filter string) bool {
+	return filter == "" || strings.EqualFold(lib.Name, filter) || fmt.Sprint(lib.ID) == filter
+}
+
+func inCollections(item *storage.Item, colls map[string]bool) bool {
+	for _, key := range item.Collections {
+		if colls[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTags checks that the item has all the given tags and none of those
+// prefixed by an exclamation mark
+func matchTags(item *storage.Item, tags []string) bool {
+	for _, tag := range tags {
+		exclude := strings.HasPrefix(tag, "!")
+		if hasTag(item, strings.TrimPrefix(tag, "!")) == exclude {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(item *storage.Item, tag string) bool {
+	for _, t := range item.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
 type matcher struct {
 	re *regexp.Regexp
 	tr *transform.Transformer
+	// Match the folded text of the items stored by sync, which is lowercase
+	// and thus only fit for case-insensitive searches
+	folded bool
 }
 
 func newMatcher(re *regexp.Regexp) matcher {
-	tr := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)),
-		runes.Map(func(r rune) rune {
-			switch r {
-			case 'Ø':
-				return 'O'
-			case 'ø':
-				return 'o'
-			case 'Ł':
-				return 'L'
-			case 'ł':
-				return 'l'
-			default:
-				return r
-			}
-		}))
-	return matcher{re, &tr}
+	tr := storage.NewSimplifier()
+	return matcher{re, &tr, false}
+}
+
+// matchFolded matches the folded version of content, when enabled
+func (m *matcher) matchFolded(content, folded string) bool {
+	if m.folded {
+		return m.re.MatchString(folded)
+	}
+	return m.match(content)
 }
 
 func (m *matcher) match(content string) bool {
-	simp, _, _ := transform.String(*m.tr, content)
-	return m.re.MatchString(simp)
+	return m.re.MatchString(storage.Simplify(*m.tr, content))
 }
 
-func (m *matcher) matchAuthors(authors []zotero.Creator) bool {
-	for _, author := range authors {
+// find returns the location in content of the first match, which is nil if
+// there is no match
+func (m *matcher) find(content string) []int {
+	simp := storage.Simplify(*m.tr, content)
+	loc := m.re.FindStringIndex(simp)
+	if loc == nil || simp == content {
+		return loc
+	}
+	start, end := storage.OriginalSpan(*m.tr, content, loc[0], loc[1])
+	return []int{start, end}
+}
+
+func (m *matcher) matchAuthors(item *storage.Item) bool {
+	if m.folded {
+		for _, name := range item.Folded.Authors {
+			if m.re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, author := range item.Creators {
 		if m.match(author.FirstName) || m.match(author.LastName) {
 			return true
 		}
@@ -6,8 +6,12 @@ package search
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/zotero"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/text/transform"
 )
@@ -29,3 +33,124 @@ func TestMatcherTransform(t *testing.T) {
 		assert.Equal(t, transformed, exp)
 	}
 }
+
+func TestMatchLibrary(t *testing.T) {
+	lib := storage.Library{Library: zotero.Library{Type: zotero.GroupLibrary, ID: 42, Name: "Team"}}
+	assert.True(t, matchLibrary(&lib, ""))
+	assert.True(t, matchLibrary(&lib, "team"))
+	assert.True(t, matchLibrary(&lib, "42"))
+	assert.False(t, matchLibrary(&lib, "other"))
+}
+
+func TestInCollections(t *testing.T) {
+	item := storage.Item{Collections: []string{"C1", "C2"}}
+	assert.True(t, inCollections(&item, map[string]bool{"C2": true}))
+	assert.False(t, inCollections(&item, map[string]bool{"C3": true}))
+	assert.False(t, inCollections(&item, map[string]bool{}))
+}
+
+func TestMatchTags(t *testing.T) {
+	item := storage.Item{Tags: []string{"to-read", "Project-X"}}
+	assert.True(t, matchTags(&item, nil))
+	assert.True(t, matchTags(&item, []string{"to-read"}))
+	assert.True(t, matchTags(&item, []string{"to-read", "project-x"}))
+	assert.True(t, matchTags(&item, []string{"to-read", "!read"}))
+	assert.False(t, matchTags(&item, []string{"to-read", "read"}))
+	assert.False(t, matchTags(&item, []string{"!to-read"}))
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("a", 50) + " needle\nin the  haystack " + strings.Repeat("b", 50)
+	loc := []int{51, 57}
+	exp := "..." + strings.Repeat("a", 39) + " needle in the haystack " + strings.Repeat("b", 22) + "..."
+	assert.Equal(t, exp, snippet(text, loc))
+	assert.Equal(t, "short needle", snippet("short needle", []int{6, 12}))
+}
+
+func TestMatchNotes(t *testing.T) {
+	notes := true
+	c := Command{flagNotes: &notes}
+	m := newMatcher(regexp.MustCompile("(?i)reading"))
+	item := storage.Item{Notes: []storage.Note{{Text: "Reading list"}, {Text: "Other"}}}
+	assert.Equal(t, []string{"Reading list"}, c.matchNotes(&m, &item))
+	m = newMatcher(regexp.MustCompile("(?i)muller"))
+	item.Notes = []storage.Note{{Text: "Ask Müller"}}
+	assert.Equal(t, []string{"Ask Müller"}, c.matchNotes(&m, &item))
+	notes = false
+	assert.Nil(t, c.matchNotes(&m, &item))
+}
+
+func TestMatchFulltext(t *testing.T) {
+	fulltext := true
+	lib := zotero.Library{Type: zotero.UserLibrary, ID: 1}
+	data := storage.NewFulltext("").Data
+	data.SetText(lib, "A1", "Introduction. We present a fuzzer.")
+	data.SetText(lib, "A2", "Nothing relevant")
+	data.SetText(zotero.Library{Type: zotero.GroupLibrary, ID: 1}, "A3", "Another fuzzer")
+	c := Command{flagFulltext: &fulltext, fulltext: &data}
+	m := newMatcher(regexp.MustCompile("(?i)fuzzer"))
+	item := storage.Item{Attachments: []storage.Attachment{{Key: "A1"}, {Key: "A2"}, {Key: "A3"}}}
+	assert.Equal(t, map[string]string{"A1": "Introduction. We present a fuzzer."},
+		c.matchFulltext(&m, lib, &item))
+	data.SetText(lib, "A2", "Fuzzing à la Böhme")
+	m = newMatcher(regexp.MustCompile("(?i)bohme"))
+	assert.Equal(t, map[string]string{"A2": "Fuzzing à la Böhme"}, c.matchFulltext(&m, lib, &item))
+	fulltext = false
+	assert.Nil(t, c.matchFulltext(&m, lib, &item))
+}
+
+func TestMatchItemFields(t *testing.T) {
+	abstract, authors := false, false
+	fields := utils.StringsFlag{"doi"}
+	c := Command{flagAbstract: &abstract, flagAuthors: &authors, flagFields: &fields}
+	m := newMatcher(regexp.MustCompile("10[.]1000"))
+	item := storage.Item{Title: "Title", Fields: map[string]string{"DOI": "10.1000/xyz"}}
+	assert.True(t, c.matchItem(&m, &item))
+	fields = nil
+	assert.False(t, c.matchItem(&m, &item))
+}
+
+func TestMatchItemStandaloneAttachment(t *testing.T) {
+	abstract, authors := false, false
+	var fields utils.StringsFlag
+	c := Command{flagAbstract: &abstract, flagAuthors: &authors, flagFields: &fields}
+	m := newMatcher(regexp.MustCompile("Smith"))
+	attach := storage.Attachment{Key: "A1", Filename: "Smith 2020.pdf"}
+	item := storage.Item{Title: "Full Text", ItemType: "attachment", Attachments: []storage.Attachment{attach}}
+	assert.True(t, c.matchItem(&m, &item))
+	// Filenames of the attachments of regular items are not matched
+	item.ItemType = "journalArticle"
+	assert.False(t, c.matchItem(&m, &item))
+}
+
+func TestMatchItemFolded(t *testing.T) {
+	abstract, authors := true, true
+	var fields utils.StringsFlag
+	c := Command{flagAbstract: &abstract, flagAuthors: &authors, flagFields: &fields}
+	item := storage.Item{
+		Title:    "Théorie",
+		Abstract: "Über",
+		Creators: []zotero.Creator{{FirstName: "Kurt", LastName: "Gödel"}},
+	}
+	item.Fold(storage.NewSimplifier())
+	assert.Equal(t, storage.FoldedText{Title: "theorie", Abstract: "uber", Authors: []string{"kurt", "godel"}},
+		item.Folded)
+
+	m := newMatcher(regexp.MustCompile("(?i)GODEL"))
+	m.folded = true
+	assert.True(t, c.matchItem(&m, &item))
+	m.re = regexp.MustCompile("(?i)^uber$")
+	assert.True(t, c.matchItem(&m, &item))
+	// Only the folded text is matched
+	item.Folded.Title = ""
+	m.re = regexp.MustCompile("(?i)theorie")
+	assert.False(t, c.matchItem(&m, &item))
+	m.folded = false
+	assert.True(t, c.matchItem(&m, &item))
+}
+
+func TestShowFields(t *testing.T) {
+	item := storage.Item{Fields: map[string]string{"DOI": "10.1000/xyz", "date": "2021"}}
+	assert.Equal(t, "date: 2021, DOI: 10.1000/xyz", showFields(&item, []string{"date", "volume", "DOI"}))
+	assert.Equal(t, "", showFields(&item, nil))
+}
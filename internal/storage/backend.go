@@ -0,0 +1,86 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/zotero"
+)
+
+// Names of the backends in the configuration
+const (
+	JSONBackend = "json"
+	BoltBackend = "bolt"
+)
+
+// Backend keeps the stored data somewhere, e.g. in a JSON file
+type Backend interface {
+	// Load reads all the stored data, upgraded to the current schema
+	Load() (StoredData, error)
+	// Update runs fn in a transaction, storing its changes only if it
+	// succeeds; concurrent updates are serialized
+	Update(fn func(Tx) error) error
+	// Drop deletes all the stored data
+	Drop() error
+}
+
+// Tx changes the stored data within Backend.Update
+type Tx interface {
+	// Libraries lists the stored libraries
+	Libraries() ([]zotero.Library, error)
+	// PutLibrary stores everything about the library but its items, which are
+	// changed with UpsertItems and DeleteItems
+	PutLibrary(lib *Library) error
+	// DeleteLibrary removes the library with all its items, if stored
+	DeleteLibrary(lib zotero.Library) error
+	// UpsertItems stores the items of the library, replacing them by key
+	UpsertItems(lib zotero.Library, items []Item) error
+	// DeleteItems removes the items of the library with the given keys
+	DeleteItems(lib zotero.Library, keys []string) error
+	// PutSearch stores the results of the last search, nil to forget them
+	PutSearch(res *SearchResults) error
+}
+
+// Open returns the storage kept in filename by the given backend, the JSON
+// one by default
+func Open(filename, backend string) (Storage, error) {
+	s := New(filename)
+	switch backend {
+	case "", JSONBackend:
+	case BoltBackend:
+		s.backend = &boltBackend{filename}
+	default:
+		return s, newErrBackend(backend)
+	}
+	return s, nil
+}
+
+// FromConfig returns the storage set in the configuration
+func FromConfig(conf config.Config) (Storage, error) {
+	return Open(conf.Storage, conf.Backend)
+}
+
+// putAll replaces all the stored data with d
+func putAll(tx Tx, d *StoredData) error {
+	stored, err := tx.Libraries()
+	if err != nil {
+		return err
+	}
+	for _, lib := range stored {
+		if err := tx.DeleteLibrary(lib); err != nil {
+			return err
+		}
+	}
+	for i := range d.Libs {
+		lib := &d.Libs[i]
+		if err := tx.PutLibrary(lib); err != nil {
+			return err
+		}
+		if err := tx.UpsertItems(lib.Library, lib.Items); err != nil {
+			return err
+		}
+	}
+	return tx.PutSearch(d.Search)
+}
@@ -0,0 +1,141 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+var backends = []string{JSONBackend, BoltBackend}
+
+func openTemp(t *testing.T, backend string) Storage {
+	s, err := Open(filepath.Join(t.TempDir(), "filename"), backend)
+	require.NoError(t, err)
+	return s
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open("filename", "sqlite")
+	var e *errBackend
+	assert.ErrorAs(t, err, &e)
+	s, err := Open("filename", "")
+	require.NoError(t, err)
+	assert.IsType(t, &jsonBackend{}, s.backend)
+}
+
+func TestBackendUpdate(t *testing.T) {
+	user := zotero.Library{Type: zotero.UserLibrary, ID: 1, Name: "Mine"}
+	group := zotero.Library{Type: zotero.GroupLibrary, ID: 2, Name: "Team"}
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			s := openTemp(t, backend)
+			var e *errReadStorage
+			assert.ErrorAs(t, s.Load(), &e)
+
+			err := s.Update(func(tx Tx) error {
+				lib := Library{Library: user, Version: 3, Collections: []Collection{{Key: "C1"}}}
+				require.NoError(t, tx.PutLibrary(&lib))
+				require.NoError(t, tx.PutLibrary(&Library{Library: group}))
+				return tx.UpsertItems(user, []Item{{Key: "A1", Title: "One"}, {Key: "A2"}, {Key: "A3"}})
+			})
+			require.NoError(t, err)
+			err = s.Update(func(tx Tx) error {
+				require.NoError(t, tx.DeleteLibrary(group))
+				require.NoError(t, tx.DeleteItems(user, []string{"A2"}))
+				return tx.UpsertItems(user, []Item{{Key: "A1", Title: "Updated"}})
+			})
+			require.NoError(t, err)
+
+			require.NoError(t, s.Load())
+			require.Len(t, s.Data.Libs, 1)
+			lib := s.Data.Libs[0]
+			assert.Equal(t, user, lib.Library)
+			assert.Equal(t, uint(3), lib.Version)
+			assert.Equal(t, []Collection{{Key: "C1"}}, lib.Collections)
+			assert.ElementsMatch(t, []Item{{Key: "A1", Title: "Updated"}, {Key: "A3"}}, lib.Items)
+			assert.Equal(t, schemaVersion, s.Data.Schema)
+
+			err = s.Update(func(tx Tx) error { return tx.UpsertItems(group, []Item{{Key: "B1"}}) })
+			var noLib *errNoLibrary
+			assert.ErrorAs(t, err, &noLib)
+
+			// Failed updates leave the storage untouched
+			err = s.Update(func(tx Tx) error {
+				require.NoError(t, tx.DeleteLibrary(user))
+				return noLib
+			})
+			assert.Error(t, err)
+			require.NoError(t, s.Load())
+			assert.Len(t, s.Data.Libs, 1)
+		})
+	}
+}
+
+func TestBackendSearch(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			writer := openTemp(t, backend)
+			reader := Storage{backend: writer.backend}
+			libs := []Library{{
+				Library: zotero.Library{Type: zotero.UserLibrary, ID: 1},
+				Items:   []Item{{Key: "A1"}},
+			}}
+			writer.Data.Libs = libs
+			require.NoError(t, writer.Persist())
+
+			// Storing the search keeps the libraries written meanwhile
+			require.NoError(t, reader.PutSearch(&SearchResults{Term: "term"}))
+			require.NoError(t, writer.Load())
+			assert.Equal(t, libs, writer.Data.Libs)
+			assert.Equal(t, "term", writer.Data.Search.Term)
+
+			require.NoError(t, reader.PutSearch(nil))
+			require.NoError(t, writer.Load())
+			assert.Nil(t, writer.Data.Search)
+
+			require.NoError(t, writer.Drop())
+			var e *errReadStorage
+			assert.ErrorAs(t, writer.Load(), &e)
+		})
+	}
+}
+
+func TestBoltUpgrade(t *testing.T) {
+	s := openTemp(t, BoltBackend)
+	s.Data.Libs = []Library{{
+		Library: zotero.Library{Type: zotero.UserLibrary, ID: 1},
+		Version: 42,
+		Items:   []Item{{Key: "A1"}},
+	}}
+	require.NoError(t, s.Persist())
+	// Pretend that the data was stored before the first migration
+	b := s.backend.(*boltBackend)
+	db, err := b.open(false)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(schemaKey, []byte("0"))
+	}))
+	require.NoError(t, db.Close())
+
+	require.NoError(t, s.Load())
+	assert.True(t, s.Data.Libs[0].NeedsResync())
+	require.NoError(t, s.PutSearch(nil))
+	db, err = b.open(true)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, schemaVersion, schemaOf(tx))
+		return nil
+	}))
+	require.NoError(t, s.Load())
+	assert.True(t, s.Data.Libs[0].NeedsResync())
+	assert.Equal(t, []Item{{Key: "A1"}}, s.Data.Libs[0].Items)
+}
@@ -0,0 +1,267 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/acidghost/zotools/internal/zotero"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Layout of the database: the meta bucket holds the schema and the search
+// results, the libraries bucket has a bucket for each library holding the
+// library itself and a bucket with its items by key
+var (
+	metaBucket      = []byte("meta")
+	librariesBucket = []byte("libraries")
+	itemsBucket     = []byte("items")
+	schemaKey       = []byte("schema")
+	searchKey       = []byte("search")
+	libraryKey      = []byte("library")
+)
+
+// boltBackend keeps the data in an embedded key-value database, where single
+// items and the search results are written without rewriting everything
+type boltBackend struct {
+	filename string
+}
+
+// open opens the database, read-only ones sharing the lock with each other
+func (b *boltBackend) open(readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(b.filename, 0644, &bolt.Options{ReadOnly: readOnly})
+}
+
+func (b *boltBackend) Load() (StoredData, error) {
+	var data StoredData
+	if _, err := os.Stat(b.filename); err != nil {
+		return data, newErrReadStorage(b.filename, err)
+	}
+	db, err := b.open(true)
+	if err != nil {
+		return data, newErrReadStorage(b.filename, err)
+	}
+	defer db.Close()
+	if err := db.View(func(tx *bolt.Tx) error { return b.read(tx, &data) }); err != nil {
+		return data, err
+	}
+	return data, migrate(b.filename, &data)
+}
+
+func (b *boltBackend) Update(fn func(Tx) error) error {
+	db, err := b.open(false)
+	if err != nil {
+		return newErrWrite(b.filename, err)
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := b.upgrade(tx); err != nil {
+			return err
+		}
+		return fn(&boltTx{b.filename, tx})
+	})
+}
+
+func (b *boltBackend) Drop() error {
+	if _, err := os.Stat(b.filename); err != nil {
+		return newErrDrop(b.filename, err)
+	}
+	// Wait for the others to be done with the database
+	db, err := b.open(false)
+	if err != nil {
+		return newErrDrop(b.filename, err)
+	}
+	defer db.Close()
+	if err := os.Remove(b.filename); err != nil {
+		return newErrDrop(b.filename, err)
+	}
+	return nil
+}
+
+// read loads all the data stored in the database
+func (b *boltBackend) read(tx *bolt.Tx, data *StoredData) error {
+	data.Schema = schemaOf(tx)
+	data.Libs = []Library{}
+	if meta := tx.Bucket(metaBucket); meta != nil && meta.Get(searchKey) != nil {
+		if err := json.Unmarshal(meta.Get(searchKey), &data.Search); err != nil {
+			return newErrNotJSON(b.filename, err)
+		}
+	}
+	libs := tx.Bucket(librariesBucket)
+	if libs == nil {
+		return nil
+	}
+	return libs.ForEach(func(name, _ []byte) error {
+		bucket := libs.Bucket(name)
+		var lib Library
+		if err := json.Unmarshal(bucket.Get(libraryKey), &lib); err != nil {
+			return newErrNotJSON(b.filename, err)
+		}
+		lib.Items = []Item{}
+		err := bucket.Bucket(itemsBucket).ForEach(func(_, v []byte) error {
+			var item Item
+			if err := json.Unmarshal(v, &item); err != nil {
+				return newErrNotJSON(b.filename, err)
+			}
+			lib.Items = append(lib.Items, item)
+			return nil
+		})
+		data.Libs = append(data.Libs, lib)
+		return err
+	})
+}
+
+// upgrade migrates the data to the current schema, rewriting all of it
+func (b *boltBackend) upgrade(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return newErrWrite(b.filename, err)
+	}
+	if schema := schemaOf(tx); schema != schemaVersion && tx.Bucket(librariesBucket) != nil {
+		var data StoredData
+		if err := b.read(tx, &data); err != nil {
+			return err
+		}
+		if err := migrate(b.filename, &data); err != nil {
+			return err
+		}
+		if err := putAll(&boltTx{b.filename, tx}, &data); err != nil {
+			return err
+		}
+	}
+	schema := []byte(strconv.FormatUint(uint64(schemaVersion), 10))
+	if err := meta.Put(schemaKey, schema); err != nil {
+		return newErrWrite(b.filename, err)
+	}
+	return nil
+}
+
+// schemaOf returns the schema of the stored data, 0 for a new database
+func schemaOf(tx *bolt.Tx) uint {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return 0
+	}
+	schema, _ := strconv.ParseUint(string(meta.Get(schemaKey)), 10, 0)
+	return uint(schema)
+}
+
+func libraryName(lib zotero.Library) []byte {
+	return []byte(fmt.Sprintf("%s:%d", lib.Type, lib.ID))
+}
+
+// boltTx changes the data within a read-write transaction
+type boltTx struct {
+	filename string
+	tx       *bolt.Tx
+}
+
+func (t *boltTx) Libraries() ([]zotero.Library, error) {
+	libs := []zotero.Library{}
+	bucket := t.tx.Bucket(librariesBucket)
+	if bucket == nil {
+		return libs, nil
+	}
+	err := bucket.ForEach(func(name, _ []byte) error {
+		var lib Library
+		if err := json.Unmarshal(bucket.Bucket(name).Get(libraryKey), &lib); err != nil {
+			return newErrNotJSON(t.filename, err)
+		}
+		libs = append(libs, lib.Library)
+		return nil
+	})
+	return libs, err
+}
+
+func (t *boltTx) PutLibrary(lib *Library) error {
+	libs, err := t.tx.CreateBucketIfNotExists(librariesBucket)
+	if err != nil {
+		return newErrWrite(t.filename, err)
+	}
+	bucket, err := libs.CreateBucketIfNotExists(libraryName(lib.Library))
+	if err != nil {
+		return newErrWrite(t.filename, err)
+	}
+	if _, err := bucket.CreateBucketIfNotExists(itemsBucket); err != nil {
+		return newErrWrite(t.filename, err)
+	}
+	// The items are stored one by one in their bucket
+	info := *lib
+	info.Items = nil
+	return t.put(bucket, libraryKey, info)
+}
+
+func (t *boltTx) DeleteLibrary(lib zotero.Library) error {
+	libs := t.tx.Bucket(librariesBucket)
+	if libs == nil {
+		return nil
+	}
+	err := libs.DeleteBucket(libraryName(lib))
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return newErrWrite(t.filename, err)
+	}
+	return nil
+}
+
+// items returns the bucket with the items of the library
+func (t *boltTx) items(lib zotero.Library) (*bolt.Bucket, error) {
+	if libs := t.tx.Bucket(librariesBucket); libs != nil {
+		if bucket := libs.Bucket(libraryName(lib)); bucket != nil {
+			return bucket.Bucket(itemsBucket), nil
+		}
+	}
+	return nil, newErrNoLibrary(lib.Name)
+}
+
+func (t *boltTx) UpsertItems(lib zotero.Library, items []Item) error {
+	bucket, err := t.items(lib)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if err := t.put(bucket, []byte(items[i].Key), &items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *boltTx) DeleteItems(lib zotero.Library, keys []string) error {
+	bucket, err := t.items(lib)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := bucket.Delete([]byte(key)); err != nil {
+			return newErrWrite(t.filename, err)
+		}
+	}
+	return nil
+}
+
+func (t *boltTx) PutSearch(res *SearchResults) error {
+	meta := t.tx.Bucket(metaBucket)
+	if res == nil {
+		if err := meta.Delete(searchKey); err != nil {
+			return newErrWrite(t.filename, err)
+		}
+		return nil
+	}
+	return t.put(meta, searchKey, res)
+}
+
+func (t *boltTx) put(bucket *bolt.Bucket, key []byte, v interface{}) error {
+	serialized, err := json.Marshal(v)
+	if err != nil {
+		return newErrSerialize(err)
+	}
+	if err := bucket.Put(key, serialized); err != nil {
+		return newErrWrite(t.filename, err)
+	}
+	return nil
+}
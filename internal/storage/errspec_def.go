@@ -123,3 +123,67 @@ func (e *errDrop) Wrap(cause error) error {
 }
 
 func (*errDrop) Is(e errSpec) bool { return e == errDropSpec }
+
+type errLock struct {
+	_errWrap
+	filename string
+}
+
+func newErrLock(filename string, err error) *errLock {
+	return &errLock{_errWrap{err}, filename}
+}
+
+func (e *errLock) Error() string {
+	return fmt.Sprintf("failed to lock %q: %v", e.filename, e.cause)
+}
+
+func (e *errLock) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*errLock) Is(e errSpec) bool { return e == errLockSpec }
+
+type errBackend struct {
+	name string
+}
+
+func newErrBackend(name string) *errBackend {
+	return &errBackend{name}
+}
+
+func (e *errBackend) Error() string {
+	return fmt.Sprintf("unknown storage backend %q", e.name)
+}
+
+func (*errBackend) Is(e errSpec) bool { return e == errBackendSpec }
+
+type errNoLibrary struct {
+	name string
+}
+
+func newErrNoLibrary(name string) *errNoLibrary {
+	return &errNoLibrary{name}
+}
+
+func (e *errNoLibrary) Error() string {
+	return fmt.Sprintf("library %q is not stored", e.name)
+}
+
+func (*errNoLibrary) Is(e errSpec) bool { return e == errNoLibrarySpec }
+
+type errSchema struct {
+	filename  string
+	version   uint
+	supported uint
+}
+
+func newErrSchema(filename string, version uint, supported uint) *errSchema {
+	return &errSchema{filename, version, supported}
+}
+
+func (e *errSchema) Error() string {
+	return fmt.Sprintf("%q uses storage schema %d, newer than %d: update zotools", e.filename, e.version, e.supported)
+}
+
+func (*errSchema) Is(e errSpec) bool { return e == errSchemaSpec }
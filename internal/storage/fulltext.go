@@ -0,0 +1,92 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/acidghost/zotools/internal/zotero"
+)
+
+// Fulltext keeps the text extracted from the attachments. It lives in its own
+// file since it is much bigger than the library and only needed by full-text
+// searches.
+type Fulltext struct {
+	filename string
+	Data     FulltextData
+}
+
+type FulltextData struct {
+	// Full-text version of each library, by library prefix
+	Versions map[string]uint
+	// Text of each attachment, by FulltextKey
+	Content map[string]string
+}
+
+func NewFulltext(filename string) Fulltext {
+	return Fulltext{filename, FulltextData{make(map[string]uint), make(map[string]string)}}
+}
+
+// FulltextFilename derives the name of the full-text storage from the one of
+// the main storage, e.g. zotools.json becomes zotools.fulltext.json; it is
+// JSON whatever the backend, so zotools.db becomes zotools.fulltext.json
+func FulltextFilename(storageFilename string) string {
+	ext := filepath.Ext(storageFilename)
+	return strings.TrimSuffix(storageFilename, ext) + ".fulltext.json"
+}
+
+func (d *FulltextData) Version(lib zotero.Library) uint {
+	return d.Versions[lib.Prefix()]
+}
+
+func (d *FulltextData) SetVersion(lib zotero.Library, version uint) {
+	d.Versions[lib.Prefix()] = version
+}
+
+// FulltextKey identifies the attachment with the given key in lib, since
+// attachments in different libraries may share the same key
+func FulltextKey(lib zotero.Library, key string) string {
+	return lib.Prefix() + "/" + key
+}
+
+// Text returns the text of the attachment with the given key in lib
+func (d *FulltextData) Text(lib zotero.Library, key string) (string, bool) {
+	text, ok := d.Content[FulltextKey(lib, key)]
+	return text, ok
+}
+
+// SetText stores the text of the attachment with the given key in lib,
+// forgetting it when empty
+func (d *FulltextData) SetText(lib zotero.Library, key, text string) {
+	if text == "" {
+		delete(d.Content, FulltextKey(lib, key))
+	} else {
+		d.Content[FulltextKey(lib, key)] = text
+	}
+}
+
+func (f *Fulltext) Load() error {
+	if err := loadJSON(f.filename, &f.Data); err != nil {
+		return err
+	}
+	// The text was keyed by attachment key alone: start over, so that the
+	// next sync fetches it again for each library
+	for key := range f.Data.Content {
+		if !strings.HasPrefix(key, "/") {
+			f.Data = FulltextData{make(map[string]uint), make(map[string]string)}
+			break
+		}
+	}
+	return nil
+}
+
+func (f *Fulltext) Persist() error {
+	return persistJSON(f.filename, f.Data)
+}
+
+func (f *Fulltext) Drop() error {
+	return drop(f.filename)
+}
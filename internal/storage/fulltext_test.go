@@ -0,0 +1,53 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFulltextFilename(t *testing.T) {
+	assert.Equal(t, "/home/user/zotools.fulltext.json", FulltextFilename("/home/user/zotools.json"))
+	assert.Equal(t, "zotools.fulltext.json", FulltextFilename("zotools"))
+	assert.Equal(t, "zotools.fulltext.json", FulltextFilename("zotools.db"))
+}
+
+func TestFulltextPersistLoad(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "filename.fulltext.json")
+	lib := zotero.Library{Type: zotero.GroupLibrary, ID: 42}
+	ft := NewFulltext(f)
+	ft.Data.SetVersion(lib, 1337)
+	ft.Data.SetText(lib, "A1", "some text")
+	require.NoError(t, ft.Persist())
+
+	loaded := NewFulltext(f)
+	require.NoError(t, loaded.Load())
+	assert.Equal(t, uint(1337), loaded.Data.Version(lib))
+	assert.Equal(t, uint(0), loaded.Data.Version(zotero.Library{Type: zotero.UserLibrary, ID: 42}))
+	text, ok := loaded.Data.Text(lib, "A1")
+	assert.True(t, ok)
+	assert.Equal(t, "some text", text)
+	_, ok = loaded.Data.Text(zotero.Library{Type: zotero.UserLibrary, ID: 42}, "A1")
+	assert.False(t, ok)
+
+	require.NoError(t, loaded.Drop())
+	assert.NoFileExists(t, f)
+}
+
+func TestFulltextLoadUnkeyed(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "filename.fulltext.json")
+	require.NoError(t, os.WriteFile(f,
+		[]byte(`{"Versions":{"/users/1":42},"Content":{"A1":"some text"}}`), 0644))
+	ft := NewFulltext(f)
+	require.NoError(t, ft.Load())
+	assert.Empty(t, ft.Data.Versions)
+	assert.Empty(t, ft.Data.Content)
+}
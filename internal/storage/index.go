@@ -0,0 +1,227 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+)
+
+// Index keeps the trigrams of the searchable text of the items, so that
+// searches only check the items that can match. It lives in its own file,
+// built by sync.
+type Index struct {
+	filename string
+	Data     IndexData
+}
+
+type IndexData struct {
+	// Index of each library, by library prefix
+	Libs map[string]*LibraryIndex
+}
+
+// IndexScope is the text of the items an index covers
+type IndexScope string
+
+const (
+	// Title and filename of the standalone attachments
+	TitleScope    IndexScope = "title"
+	AbstractScope IndexScope = "abstract"
+	// First and last names of the creators
+	AuthorsScope IndexScope = "authors"
+)
+
+// LibraryIndex maps each trigram to the items containing it
+type LibraryIndex struct {
+	// Version of the library when indexed
+	Version uint
+	// Keys of the indexed items
+	Keys []string
+	// Positions in Keys of the items containing each trigram, by scope and
+	// trigram, as increasing varint deltas
+	Postings map[IndexScope]map[string][]byte
+}
+
+// Length in runes of the substrings indexed
+const trigramLen = 3
+
+// Type of the standalone attachments, whose filename is indexed with the title
+const attachmentType = "attachment"
+
+func NewIndex(filename string) Index {
+	return Index{filename, IndexData{make(map[string]*LibraryIndex)}}
+}
+
+// IndexFilename derives the name of the index from the one of the main
+// storage, e.g. zotools.json or zotools.db becomes zotools.index.json
+func IndexFilename(storageFilename string) string {
+	ext := filepath.Ext(storageFilename)
+	return strings.TrimSuffix(storageFilename, ext) + ".index.json"
+}
+
+func (i *Index) Load() error {
+	return loadJSON(i.filename, &i.Data)
+}
+
+func (i *Index) Persist() error {
+	return persistJSON(i.filename, i.Data)
+}
+
+func (i *Index) Drop() error {
+	return drop(i.filename)
+}
+
+// Library returns the index of lib, or nil if missing or outdated
+func (d *IndexData) Library(lib *Library) *LibraryIndex {
+	idx := d.Libs[lib.Prefix()]
+	if idx == nil || idx.Version != lib.Version || lib.NeedsResync() {
+		return nil
+	}
+	return idx
+}
+
+// SetLibrary replaces the index of lib
+func (d *IndexData) SetLibrary(lib *Library) {
+	d.Libs[lib.Prefix()] = BuildIndex(lib)
+}
+
+// BuildIndex indexes the items of the library
+func BuildIndex(lib *Library) *LibraryIndex {
+	idx := &LibraryIndex{
+		Version: lib.Version,
+		Keys:    make([]string, 0, len(lib.Items)),
+	}
+	positions := map[IndexScope]map[string][]uint32{
+		TitleScope:    {},
+		AbstractScope: {},
+		AuthorsScope:  {},
+	}
+	tr := NewSimplifier()
+	add := func(scope IndexScope, pos uint32, texts ...string) {
+		seen := map[string]bool{}
+		for _, text := range texts {
+			for _, trigram := range Trigrams(text) {
+				if !seen[trigram] {
+					seen[trigram] = true
+					positions[scope][trigram] = append(positions[scope][trigram], pos)
+				}
+			}
+		}
+	}
+	// The same folded text the searches match
+	for i := range lib.Items {
+		item := &lib.Items[i]
+		pos := uint32(len(idx.Keys))
+		idx.Keys = append(idx.Keys, item.Key)
+		titles := []string{item.Folded.Title}
+		if item.ItemType == attachmentType {
+			for _, attach := range item.Attachments {
+				titles = append(titles, strings.ToLower(Simplify(tr, attach.Filename)))
+			}
+		}
+		add(TitleScope, pos, titles...)
+		add(AbstractScope, pos, item.Folded.Abstract)
+		add(AuthorsScope, pos, item.Folded.Authors...)
+	}
+
+	idx.Postings = make(map[IndexScope]map[string][]byte, len(positions))
+	for scope, byTrigram := range positions {
+		idx.Postings[scope] = make(map[string][]byte, len(byTrigram))
+		for trigram, list := range byTrigram {
+			idx.Postings[scope][trigram] = encodePostings(list)
+		}
+	}
+	return idx
+}
+
+// Candidates returns the keys of the items whose text in any of the scopes
+// contains all the trigrams, which should be lowercase and simplified; no
+// trigrams select no items
+func (idx *LibraryIndex) Candidates(trigrams []string, scopes ...IndexScope) map[string]bool {
+	found := make(map[string]bool)
+	for _, scope := range scopes {
+		var matching []uint32
+		for i, trigram := range trigrams {
+			list := decodePostings(idx.Postings[scope][trigram])
+			if i == 0 {
+				matching = list
+			} else {
+				matching = intersect(matching, list)
+			}
+			if len(matching) == 0 {
+				break
+			}
+		}
+		for _, pos := range matching {
+			found[idx.Keys[pos]] = true
+		}
+	}
+	return found
+}
+
+// Trigrams returns the distinct substrings of three runes of s
+func Trigrams(s string) []string {
+	runes := []rune(s)
+	seen := make(map[string]bool)
+	trigrams := []string{}
+	for i := 0; i+trigramLen <= len(runes); i++ {
+		trigram := string(runes[i : i+trigramLen])
+		if !seen[trigram] {
+			seen[trigram] = true
+			trigrams = append(trigrams, trigram)
+		}
+	}
+	return trigrams
+}
+
+func encodePostings(list []uint32) []byte {
+	buf := make([]byte, 0, len(list))
+	var prev uint32
+	for _, pos := range list {
+		buf = appendUvarint(buf, uint64(pos-prev))
+		prev = pos
+	}
+	return buf
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func decodePostings(buf []byte) []uint32 {
+	list := []uint32{}
+	var pos uint32
+	for len(buf) > 0 {
+		delta, n := binary.Uvarint(buf)
+		if n <= 0 {
+			break
+		}
+		buf = buf[n:]
+		pos += uint32(delta)
+		list = append(list, pos)
+	}
+	return list
+}
+
+// intersect returns the positions in both the sorted lists
+func intersect(a, b []uint32) []uint32 {
+	both := a[:0]
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			both = append(both, a[i])
+			i++
+			j++
+		}
+	}
+	return both
+}
@@ -0,0 +1,77 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexFilename(t *testing.T) {
+	assert.Equal(t, "/home/user/zotools.index.json", IndexFilename("/home/user/zotools.json"))
+	assert.Equal(t, "zotools.index.json", IndexFilename("zotools.db"))
+}
+
+func TestBuildIndex(t *testing.T) {
+	lib := Library{
+		Library: zotero.Library{Type: zotero.UserLibrary, ID: 1},
+		Version: 7,
+		Items: []Item{
+			{Key: "A1", Title: "Gödel, Escher, Bach", Creators: []zotero.Creator{{LastName: "Hofstadter"}}},
+			{Key: "A2", Title: "Escher's drawings", Abstract: "About Bach"},
+			{Key: "A3", ItemType: "attachment", Attachments: []Attachment{{Filename: "bach.pdf"}}},
+		},
+	}
+	foldAll(&StoredData{Libs: []Library{lib}})
+	idx := BuildIndex(&lib)
+	assert.Equal(t, uint(7), idx.Version)
+
+	candidates := func(term string, scopes ...IndexScope) map[string]bool {
+		return idx.Candidates(Trigrams(term), scopes...)
+	}
+	assert.Equal(t, map[string]bool{"A1": true, "A3": true}, candidates("bach", TitleScope))
+	assert.Equal(t, map[string]bool{"A1": true, "A2": true, "A3": true},
+		candidates("bach", TitleScope, AbstractScope))
+	assert.Equal(t, map[string]bool{"A1": true}, candidates("godel", TitleScope))
+	assert.Equal(t, map[string]bool{"A1": true}, candidates("stadt", AuthorsScope))
+	assert.Empty(t, candidates("escherbach", TitleScope))
+	assert.Empty(t, candidates("", TitleScope))
+
+	var data IndexData
+	data.Libs = map[string]*LibraryIndex{}
+	assert.Nil(t, data.Library(&lib))
+	data.SetLibrary(&lib)
+	assert.NotNil(t, data.Library(&lib))
+	lib.Version++
+	assert.Nil(t, data.Library(&lib))
+}
+
+func TestIndexPersistLoad(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "filename.index.json")
+	lib := Library{Library: zotero.Library{Type: zotero.GroupLibrary, ID: 42}, Version: 1}
+	for i := 0; i < 300; i++ {
+		lib.Items = append(lib.Items, Item{Key: string(rune('A' + i%26)), Title: "same title"})
+	}
+	foldAll(&StoredData{Libs: []Library{lib}})
+	index := NewIndex(f)
+	index.Data.SetLibrary(&lib)
+	require.NoError(t, index.Persist())
+
+	loaded := NewIndex(f)
+	require.NoError(t, loaded.Load())
+	idx := loaded.Data.Library(&lib)
+	require.NotNil(t, idx)
+	assert.Len(t, decodePostings(idx.Postings[TitleScope]["tit"]), 300)
+}
+
+func TestTrigrams(t *testing.T) {
+	assert.Equal(t, []string{"aaa"}, Trigrams("aaaa"))
+	assert.Equal(t, []string{"été", "tés"}, Trigrams("étés"))
+	assert.Empty(t, Trigrams("ab"))
+}
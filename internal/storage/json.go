@@ -0,0 +1,164 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/acidghost/zotools/internal/zotero"
+)
+
+// jsonBackend keeps all the data in a single JSON file, rewritten whole on
+// every update
+type jsonBackend struct {
+	filename string
+}
+
+func (b *jsonBackend) Load() (StoredData, error) {
+	// Files written before the schema was introduced do not have one
+	var data StoredData
+	var raw map[string]json.RawMessage
+	if err := loadJSON(b.filename, &raw); err != nil {
+		return data, err
+	}
+	if err := b.decode(raw, &data); err != nil {
+		return data, err
+	}
+	if data.Libs == nil {
+		data.Libs = []Library{}
+	}
+	return data, migrate(b.filename, &data)
+}
+
+func (b *jsonBackend) Update(fn func(Tx) error) error {
+	unlock, err := defaultLock(b.filename, true)
+	if err != nil {
+		return newErrWrite(b.filename, err)
+	}
+	defer unlock()
+	data := New(b.filename).Data
+	if _, err := os.Stat(b.filename); err == nil {
+		data.Schema = 0
+		var raw map[string]json.RawMessage
+		if err := readJSON(b.filename, &raw); err != nil {
+			return err
+		}
+		if err := b.decode(raw, &data); err != nil {
+			return err
+		}
+		if err := migrate(b.filename, &data); err != nil {
+			return err
+		}
+	}
+	if err := fn(&jsonTx{&data}); err != nil {
+		return err
+	}
+	tmp, err := writeTemp(b.filename, data)
+	if err != nil {
+		return err
+	}
+	return commit(tmp, b.filename)
+}
+
+func (b *jsonBackend) Drop() error {
+	return drop(b.filename)
+}
+
+// decode decodes the stored data, upgrading first the layout of the files
+// written by older versions of zotools
+func (b *jsonBackend) decode(raw map[string]json.RawMessage, data *StoredData) error {
+	if err := migrateLayout(raw); err != nil {
+		return newErrNotJSON(b.filename, err)
+	}
+	serialized, err := json.Marshal(raw)
+	if err != nil {
+		return newErrNotJSON(b.filename, err)
+	}
+	if err := json.Unmarshal(serialized, data); err != nil {
+		return newErrNotJSON(b.filename, err)
+	}
+	return nil
+}
+
+// jsonTx changes the data in memory, written by jsonBackend.Update at the end
+type jsonTx struct {
+	data *StoredData
+}
+
+func (tx *jsonTx) Libraries() ([]zotero.Library, error) {
+	libs := make([]zotero.Library, 0, len(tx.data.Libs))
+	for i := range tx.data.Libs {
+		libs = append(libs, tx.data.Libs[i].Library)
+	}
+	return libs, nil
+}
+
+func (tx *jsonTx) PutLibrary(lib *Library) error {
+	stored := tx.data.Library(lib.Library)
+	if stored == nil {
+		tx.data.Libs = append(tx.data.Libs, Library{Library: lib.Library, Items: []Item{}})
+		stored = &tx.data.Libs[len(tx.data.Libs)-1]
+	}
+	stored.Library = lib.Library
+	stored.Version = lib.Version
+	stored.Collections = lib.Collections
+	return nil
+}
+
+func (tx *jsonTx) DeleteLibrary(lib zotero.Library) error {
+	kept := tx.data.Libs[:0]
+	for _, stored := range tx.data.Libs {
+		if stored.Type != lib.Type || stored.ID != lib.ID {
+			kept = append(kept, stored)
+		}
+	}
+	tx.data.Libs = kept
+	return nil
+}
+
+func (tx *jsonTx) UpsertItems(lib zotero.Library, items []Item) error {
+	stored := tx.data.Library(lib)
+	if stored == nil {
+		return newErrNoLibrary(lib.Name)
+	}
+	byKey := make(map[string]int, len(stored.Items))
+	for i := range stored.Items {
+		byKey[stored.Items[i].Key] = i
+	}
+	for _, item := range items {
+		if i, exists := byKey[item.Key]; exists {
+			stored.Items[i] = item
+		} else {
+			stored.Items = append(stored.Items, item)
+			byKey[item.Key] = len(stored.Items) - 1
+		}
+	}
+	return nil
+}
+
+func (tx *jsonTx) DeleteItems(lib zotero.Library, keys []string) error {
+	stored := tx.data.Library(lib)
+	if stored == nil {
+		return newErrNoLibrary(lib.Name)
+	}
+	toRemove := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		toRemove[key] = true
+	}
+	kept := stored.Items[:0]
+	for _, item := range stored.Items {
+		if !toRemove[item.Key] {
+			kept = append(kept, item)
+		}
+	}
+	stored.Items = kept
+	return nil
+}
+
+func (tx *jsonTx) PutSearch(res *SearchResults) error {
+	tx.data.Search = res
+	return nil
+}
@@ -0,0 +1,50 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+const lockSuffix = ".lock"
+
+// Takes the advisory lock guarding filename, replaced in tests
+var defaultLock = lockFile
+
+// lockFile locks the file next to filename, shared for readers and exclusive
+// for writers, and returns the function releasing the lock. The lock file is
+// never removed, otherwise two commands could end up locking different files.
+func lockFile(filename string, exclusive bool) (func(), error) {
+	f, err := os.OpenFile(filename+lockSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, newErrLock(filename, err)
+	}
+	if err := flock(f, exclusive); err != nil {
+		f.Close()
+		return nil, newErrLock(filename, err)
+	}
+	return func() {
+		//nolint:errcheck
+		funlock(f)
+		f.Close()
+	}, nil
+}
+
+// readLock takes the shared lock, if there is anything to read. Reading goes
+// on without the lock when the lock file cannot be created, e.g. because the
+// folder is read-only, as no command can write there either.
+func readLock(filename string) (func(), error) {
+	if _, err := fs.Stat(defaultFS, filename); errors.Is(err, fs.ErrNotExist) {
+		return func() {}, nil
+	}
+	unlock, err := defaultLock(filename, false)
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) && pathErr.Op == "open" {
+		return func() {}, nil
+	}
+	return unlock, err
+}
@@ -0,0 +1,15 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package storage
+
+import "os"
+
+// Without flock the writes are still atomic, but not serialized
+func flock(f *os.File, exclusive bool) error { return nil }
+
+func funlock(f *os.File) error { return nil }
@@ -0,0 +1,128 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"encoding/json"
+
+	"github.com/acidghost/zotools/internal/zotero"
+)
+
+// A migration upgrades the stored data by one schema version. Changes to the
+// layout are made by layout on the JSON not yet decoded, then the data is
+// decoded with the current types and data only has to fill the fields added
+// in its version; those depending on Zotero are filled by resyncing.
+type migration struct {
+	layout func(raw map[string]json.RawMessage) error
+	data   func(d *StoredData)
+}
+
+// migrations[i] upgrades the data from schema i to schema i+1, new ones are
+// appended at the end
+var migrations = []migration{
+	// The single library became a list with the group libraries; attachments
+	// got link mode, path and URL, and standalone attachments are now kept,
+	// none of which is known without fetching all the items again
+	{layout: singleLibrary, data: resyncAll},
+	// Items keep their searchable text
+	{data: foldAll},
+}
+
+// Version of the schema written by this version of zotools
+var schemaVersion = uint(len(migrations))
+
+// migrateLayout upgrades the layout of the JSON data to the current schema,
+// before it is decoded and migrated
+func migrateLayout(raw map[string]json.RawMessage) error {
+	var schema uint
+	if s, ok := raw["Schema"]; ok {
+		if err := json.Unmarshal(s, &schema); err != nil {
+			return err
+		}
+	}
+	for v := schema; v < schemaVersion; v++ {
+		if migrations[v].layout == nil {
+			continue
+		}
+		if err := migrations[v].layout(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate upgrades data read from filename to the current schema
+func migrate(filename string, d *StoredData) error {
+	if d.Schema > schemaVersion {
+		return newErrSchema(filename, d.Schema, schemaVersion)
+	}
+	for v := d.Schema; v < schemaVersion; v++ {
+		if migrations[v].data != nil {
+			migrations[v].data(d)
+		}
+		d.migrated = true
+	}
+	d.Schema = schemaVersion
+	return nil
+}
+
+// Migrated tells whether the data was loaded from an older schema, and so
+// differs from what is stored until it is written again
+func (d *StoredData) Migrated() bool {
+	return d.migrated
+}
+
+// singleLibrary moves the single library of the files written before zotools
+// supported group libraries into Libs. It is the user library, whose ID was
+// not stored, so it is left to the next sync to fetch it again.
+func singleLibrary(raw map[string]json.RawMessage) error {
+	legacy, ok := raw["Lib"]
+	if !ok {
+		return nil
+	}
+	delete(raw, "Lib")
+	if _, ok := raw["Libs"]; ok {
+		return nil
+	}
+	lib := Library{Library: zotero.Library{Type: zotero.UserLibrary, Name: "user"}}
+	if err := json.Unmarshal(legacy, &lib); err != nil {
+		return err
+	}
+	lib.Resync()
+	libs, err := json.Marshal([]Library{lib})
+	if err != nil {
+		return err
+	}
+	raw["Libs"] = libs
+	return nil
+}
+
+// resyncAll makes the next sync fetch again all the libraries
+func resyncAll(d *StoredData) {
+	for i := range d.Libs {
+		d.Libs[i].Resync()
+	}
+}
+
+// foldAll computes the searchable text of all the items
+func foldAll(d *StoredData) {
+	tr := NewSimplifier()
+	for i := range d.Libs {
+		for j := range d.Libs[i].Items {
+			d.Libs[i].Items[j].Fold(tr)
+		}
+	}
+}
+
+// Resync makes the next sync fetch again the whole library, the stored items
+// are still searchable until then
+func (l *Library) Resync() {
+	l.Version = 0
+}
+
+// NeedsResync tells whether the library was never completely synchronized
+func (l *Library) NeedsResync() bool {
+	return l.Version == 0
+}
@@ -0,0 +1,89 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Run("Unversioned", func(t *testing.T) {
+		f := filepath.Join(t.TempDir(), "filename.json")
+		legacy := `{"Libs":[{"Type":"user","ID":1,"Name":"Mine","Version":42,"Items":[{"Key":"A1","Title":"Été"}]}],"Search":null}`
+		require.NoError(t, os.WriteFile(f, []byte(legacy), 0644))
+		s := New(f)
+		require.NoError(t, s.Load())
+		assert.Equal(t, schemaVersion, s.Data.Schema)
+		require.Len(t, s.Data.Libs, 1)
+		assert.True(t, s.Data.Libs[0].NeedsResync())
+		require.Len(t, s.Data.Libs[0].Items, 1)
+		assert.Equal(t, "ete", s.Data.Libs[0].Items[0].Folded.Title)
+		assert.True(t, s.Data.Migrated())
+
+		// The resync mark survives the updates made before the next sync
+		require.NoError(t, s.PutSearch(&SearchResults{}))
+		check := New(f)
+		require.NoError(t, check.Load())
+		assert.True(t, check.Data.Libs[0].NeedsResync())
+		assert.False(t, check.Data.Migrated())
+	})
+	t.Run("Single library", func(t *testing.T) {
+		// Written before zotools supported group libraries
+		bs, err := os.ReadFile(filepath.Join("assets", "storage_lib.json"))
+		require.NoError(t, err)
+		f := filepath.Join(t.TempDir(), "filename.json")
+		require.NoError(t, os.WriteFile(f, bs, 0644))
+		s := New(f)
+		require.NoError(t, s.Load())
+		assert.Equal(t, schemaVersion, s.Data.Schema)
+		require.Len(t, s.Data.Libs, 1)
+		lib := s.Data.Libs[0]
+		assert.Equal(t, zotero.UserLibrary, lib.Type)
+		assert.True(t, lib.NeedsResync())
+		assert.Len(t, lib.Items, 151)
+		require.NotNil(t, s.Data.Search)
+		assert.Equal(t, "uninfindable", s.Data.Search.Term)
+
+		// Nothing is lost when the search results are stored
+		require.NoError(t, s.PutSearch(&SearchResults{Term: "learn"}))
+		check := New(f)
+		require.NoError(t, check.Load())
+		require.Len(t, check.Data.Libs, 1)
+		assert.Len(t, check.Data.Libs[0].Items, 151)
+	})
+	t.Run("Current", func(t *testing.T) {
+		d := StoredData{Schema: schemaVersion, Libs: []Library{{Version: 42}}}
+		require.NoError(t, migrate("filename.json", &d))
+		assert.False(t, d.Libs[0].NeedsResync())
+		assert.False(t, d.Migrated())
+	})
+	t.Run("Newer", func(t *testing.T) {
+		d := StoredData{Schema: schemaVersion + 1}
+		err := migrate("filename.json", &d)
+		var e *errSchema
+		assert.ErrorAs(t, err, &e)
+	})
+	t.Run("In order", func(t *testing.T) {
+		oldMigrations, oldVersion := migrations, schemaVersion
+		t.Cleanup(func() { migrations, schemaVersion = oldMigrations, oldVersion })
+		applied := []int{}
+		migrations = []migration{
+			{data: func(*StoredData) { applied = append(applied, 0) }},
+			{data: func(*StoredData) { applied = append(applied, 1) }},
+			{data: func(*StoredData) { applied = append(applied, 2) }},
+		}
+		schemaVersion = uint(len(migrations))
+		d := StoredData{Schema: 1}
+		require.NoError(t, migrate("filename.json", &d))
+		assert.Equal(t, []int{1, 2}, applied)
+		assert.Equal(t, uint(3), d.Schema)
+	})
+}
@@ -8,26 +8,35 @@ import (
 	"encoding/json"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/acidghost/zotools/internal/utils"
 	"github.com/acidghost/zotools/internal/zotero"
+	"golang.org/x/text/transform"
 )
 
 var defaultFS fs.FS = &utils.DummyFS{}
 
 type Storage struct {
-	filename string
-	Data     StoredData
+	backend Backend
+	Data    StoredData
 }
 
 type StoredData struct {
-	Lib    Library
+	// Version of the format, see migrations
+	Schema uint
+	Libs   []Library
 	Search *SearchResults
+	// Whether it was upgraded from an older schema when loaded
+	migrated bool
 }
 
 type Library struct {
-	Version uint
-	Items   []Item
+	zotero.Library
+	Version     uint
+	Items       []Item
+	Collections []Collection
 }
 
 type Item struct {
@@ -37,7 +46,59 @@ type Item struct {
 	Abstract    string
 	ItemType    string
 	Creators    []zotero.Creator
+	Collections []string
+	Tags        []string
 	Attachments []Attachment
+	Notes       []Note
+	// All the other metadata of the item, e.g. date, DOI, url, etc.
+	Fields map[string]string
+	// Searchable text, computed by Fold
+	Folded FoldedText
+}
+
+// FoldedText is the text of an item as searched: lowercase and without
+// diacritics
+type FoldedText struct {
+	Title    string
+	Abstract string
+	// First and last names of the creators
+	Authors []string
+}
+
+// Fold computes the searchable text of the item with tr, a simplifier
+func (i *Item) Fold(tr transform.Transformer) {
+	fold := func(s string) string {
+		return strings.ToLower(Simplify(tr, s))
+	}
+	i.Folded = FoldedText{Title: fold(i.Title), Abstract: fold(i.Abstract)}
+	for _, creator := range i.Creators {
+		for _, name := range []string{creator.FirstName, creator.LastName} {
+			if name != "" {
+				i.Folded.Authors = append(i.Folded.Authors, fold(name))
+			}
+		}
+	}
+}
+
+// Field returns the value of the metadata field with the given name, ignoring
+// case, or an empty string if the item does not have it
+func (i *Item) Field(name string) string {
+	if value, ok := i.Fields[name]; ok {
+		return value
+	}
+	for field, value := range i.Fields {
+		if strings.EqualFold(field, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+type Collection struct {
+	Key       string
+	Version   uint
+	Name      string
+	ParentKey string
 }
 
 type Attachment struct {
@@ -45,6 +106,22 @@ type Attachment struct {
 	Version     uint
 	ContentType string
 	Filename    string
+	MD5         string
+	// Modification time in milliseconds since the epoch
+	MTime int64
+	// How the file is stored, e.g. linked_file
+	LinkMode string
+	// Path of linked files, possibly relative to the base directory
+	Path string
+	// Address of linked URLs and snapshots
+	URL string
+}
+
+// Note is a child note, with its HTML content converted to plain text
+type Note struct {
+	Key     string
+	Version uint
+	Text    string
 }
 
 type SearchResults struct {
@@ -53,9 +130,15 @@ type SearchResults struct {
 }
 
 type SearchResultsItem struct {
+	Library     zotero.Library
 	Key         string
 	Filename    string
 	ContentType string
+	MD5         string
+	MTime       int64
+	LinkMode    string
+	Path        string
+	URL         string
 }
 
 type errSpec string
@@ -66,43 +149,216 @@ const (
 	errSerializeSpec   = errSpec("wrap:failed to serialize as JSON")
 	errWriteSpec       = errSpec("wrap:failed to write to {{filename string %q}}")
 	errDropSpec        = errSpec("wrap:failed to delete {{filename string %q}}")
+	errLockSpec        = errSpec("wrap:failed to lock {{filename string %q}}")
+	errBackendSpec     = errSpec("nowrap:unknown storage backend {{name string %q}}")
+	errNoLibrarySpec   = errSpec("nowrap:library {{name string %q}} is not stored")
+	errSchemaSpec      = errSpec("nowrap:{{filename string %q}} uses storage schema {{version uint %d}}, newer than {{supported uint %d}}: update zotools")
 )
 
 //go:generate gorror -type=errSpec -suffix=Spec
 
 func New(filename string) Storage {
 	var data StoredData
-	data.Lib = Library{0, []Item{}}
-	return Storage{filename, data}
+	data.Schema = schemaVersion
+	data.Libs = []Library{}
+	return Storage{&jsonBackend{filename}, data}
+}
+
+// Library returns the stored library identified by lib, or nil if missing
+func (d *StoredData) Library(lib zotero.Library) *Library {
+	for i := range d.Libs {
+		if d.Libs[i].Type == lib.Type && d.Libs[i].ID == lib.ID {
+			return &d.Libs[i]
+		}
+	}
+	return nil
+}
+
+// Collection returns the collection with the given key, or nil if missing
+func (l *Library) Collection(key string) *Collection {
+	for i := range l.Collections {
+		if l.Collections[i].Key == key {
+			return &l.Collections[i]
+		}
+	}
+	return nil
+}
+
+// CollectionPath returns the names of the collection and of its ancestors
+// joined by slashes, e.g. "Thesis/Related work"
+func (l *Library) CollectionPath(key string) string {
+	names := []string{}
+	// Bound the walk by the number of collections in case of broken parents
+	for i := 0; i <= len(l.Collections); i++ {
+		coll := l.Collection(key)
+		if coll == nil {
+			break
+		}
+		names = append([]string{coll.Name}, names...)
+		key = coll.ParentKey
+	}
+	return strings.Join(names, "/")
+}
+
+// FindCollections returns the keys of the collections whose name or path is
+// equal to nameOrPath, ignoring case. When recursive is true the keys of all
+// their subcollections are returned as well.
+func (l *Library) FindCollections(nameOrPath string, recursive bool) map[string]bool {
+	keys := make(map[string]bool)
+	for i := range l.Collections {
+		coll := &l.Collections[i]
+		if strings.EqualFold(coll.Name, nameOrPath) ||
+			strings.EqualFold(l.CollectionPath(coll.Key), nameOrPath) {
+			keys[coll.Key] = true
+		}
+	}
+	if !recursive {
+		return keys
+	}
+	// Keep adding children until no new collection is found
+	for added := true; added; {
+		added = false
+		for i := range l.Collections {
+			coll := &l.Collections[i]
+			if !keys[coll.Key] && keys[coll.ParentKey] {
+				keys[coll.Key] = true
+				added = true
+			}
+		}
+	}
+	return keys
+}
+
+// NumItems counts the top level items across all the libraries
+func (d *StoredData) NumItems() int {
+	n := 0
+	for i := range d.Libs {
+		n += len(d.Libs[i].Items)
+	}
+	return n
 }
 
 func (s *Storage) Load() error {
-	storeBytes, err := fs.ReadFile(defaultFS, s.filename)
+	data, err := s.backend.Load()
 	if err != nil {
-		return newErrReadStorage(s.filename, err)
-	}
-	if err := json.Unmarshal(storeBytes, &s.Data); err != nil {
-		return newErrNotJSON(s.filename, err)
+		return err
 	}
+	s.Data = data
 	return nil
 }
 
+// Persist replaces all the stored data with s.Data
 func (s *Storage) Persist() error {
-	serialized, err := json.Marshal(s.Data)
+	return s.backend.Update(func(tx Tx) error { return putAll(tx, &s.Data) })
+}
+
+// Update changes the stored data in a transaction, so that the changes made
+// by concurrent invocations are not lost; s.Data is left as it is
+func (s *Storage) Update(fn func(Tx) error) error {
+	return s.backend.Update(fn)
+}
+
+// PutSearch stores the results of the last search, nil to forget them
+func (s *Storage) PutSearch(res *SearchResults) error {
+	err := s.backend.Update(func(tx Tx) error { return tx.PutSearch(res) })
+	if err == nil {
+		s.Data.Search = res
+	}
+	return err
+}
+
+func (s *Storage) Drop() error {
+	return s.backend.Drop()
+}
+
+func loadJSON(filename string, v interface{}) error {
+	unlock, err := readLock(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return readJSON(filename, v)
+}
+
+func readJSON(filename string, v interface{}) error {
+	storeBytes, err := fs.ReadFile(defaultFS, filename)
+	if err != nil {
+		return newErrReadStorage(filename, err)
+	}
+	if err := json.Unmarshal(storeBytes, v); err != nil {
+		return newErrNotJSON(filename, err)
+	}
+	return nil
+}
+
+// persistJSON replaces filename atomically, so that neither a crash nor a
+// concurrent reader ever sees a partially written file
+func persistJSON(filename string, v interface{}) error {
+	tmp, err := writeTemp(filename, v)
+	if err != nil {
+		return err
+	}
+	unlock, err := defaultLock(filename, true)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	defer unlock()
+	return commit(tmp, filename)
+}
+
+// writeTemp serializes v to a synced temporary file next to filename
+func writeTemp(filename string, v interface{}) (string, error) {
+	serialized, err := json.Marshal(v)
+	if err != nil {
+		return "", newErrSerialize(err)
+	}
+	dir, base := filepath.Split(filename)
+	f, err := os.CreateTemp(dir, base+".*.tmp")
 	if err != nil {
-		return newErrSerialize(err)
+		return "", newErrWrite(filename, err)
+	}
+	_, err = f.Write(serialized)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
 	}
-	err = os.WriteFile(s.filename, serialized, 0644)
 	if err != nil {
-		return newErrWrite(s.filename, err)
+		os.Remove(f.Name())
+		return "", newErrWrite(filename, err)
+	}
+	return f.Name(), nil
+}
+
+// commit renames tmp over filename, to be called holding the exclusive lock
+func commit(tmp, filename string) error {
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return newErrWrite(filename, err)
+	}
+	// Make the rename itself durable, not supported everywhere
+	if dir, err := os.Open(filepath.Dir(filename)); err == nil {
+		//nolint:errcheck
+		dir.Sync()
+		dir.Close()
 	}
 	return nil
 }
 
-func (s *Storage) Drop() (err error) {
-	err = os.Remove(s.filename)
+func drop(filename string) (err error) {
+	unlock, err := defaultLock(filename, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = os.Remove(filename)
 	if err != nil {
-		err = newErrDrop(s.filename, err)
+		err = newErrDrop(filename, err)
 	}
 	return
 }
@@ -10,14 +10,17 @@ import (
 	"path/filepath"
 	"testing"
 	"testing/fstest"
+	"time"
 
+	"github.com/acidghost/zotools/internal/zotero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestStorageLoad(t *testing.T) {
-	oldFS := defaultFS
-	t.Cleanup(func() { defaultFS = oldFS })
+	oldFS, oldLock := defaultFS, defaultLock
+	t.Cleanup(func() { defaultFS, defaultLock = oldFS, oldLock })
+	defaultLock = func(string, bool) (func(), error) { return func() {}, nil }
 	t.Run("Read error", func(t *testing.T) {
 		defaultFS = fstest.MapFS(map[string]*fstest.MapFile{})
 		s := New("filename.json")
@@ -35,22 +38,52 @@ func TestStorageLoad(t *testing.T) {
 		var e *errNotJSON
 		assert.ErrorAs(t, err, &e)
 	})
+	t.Run("Single library", func(t *testing.T) {
+		f := "filename.json"
+		defaultFS = fstest.MapFS(map[string]*fstest.MapFile{
+			f: {Data: []byte(`{"Lib":{"Version":42,"Items":[{"Key":"A1","Title":"T"}]},"Search":null}`)},
+		})
+		s := New(f)
+		require.NoError(t, s.Load())
+		require.Len(t, s.Data.Libs, 1)
+		lib := s.Data.Libs[0]
+		assert.Equal(t, zotero.UserLibrary, lib.Type)
+		assert.True(t, lib.NeedsResync())
+		require.Len(t, lib.Items, 1)
+		assert.Equal(t, "A1", lib.Items[0].Key)
+	})
 }
 
 func TestStoragePersist(t *testing.T) {
 	t.Run("Persist file", func(t *testing.T) {
 		f := filepath.Join(t.TempDir(), "filename.json")
 		s := New(f)
-		s.Data.Lib.Version = 0
-		s.Data.Lib.Items = []Item{}
 		s.Data.Search = nil
 		err := s.Persist()
 		require.NoError(t, err)
 		bs, err := os.ReadFile(f)
 		assert.NoError(t, err)
-		exp := `{"Lib":{"Version":0,"Items":[]},"Search":null}`
+		exp := `{"Schema":2,"Libs":[],"Search":null}`
 		assert.Equal(t, string(bs), exp)
 	})
+	t.Run("Replace file", func(t *testing.T) {
+		dir := t.TempDir()
+		f := filepath.Join(dir, "filename.json")
+		require.NoError(t, os.WriteFile(f, []byte(`{"Libs":[{"Version":1}]}`), 0600))
+		s := New(f)
+		require.NoError(t, s.Persist())
+		require.NoError(t, s.Load())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.ElementsMatch(t, []string{"filename.json", "filename.json.lock"}, names)
+		info, err := os.Stat(f)
+		require.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0644), info.Mode().Perm())
+	})
 	t.Run("Not existent folder", func(t *testing.T) {
 		f := filepath.Join(t.TempDir(), "somefolder", "filename.json")
 		s := New(f)
@@ -62,6 +95,54 @@ func TestStoragePersist(t *testing.T) {
 	})
 }
 
+func TestLockFile(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "filename.json")
+	unlockRead, err := lockFile(f, false)
+	require.NoError(t, err)
+	unlockOther, err := lockFile(f, false)
+	require.NoError(t, err)
+	unlockOther()
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := lockFile(f, true)
+		assert.NoError(t, err)
+		locked <- unlock
+	}()
+	select {
+	case <-locked:
+		t.Fatal("exclusive lock taken while shared lock held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlockRead()
+	(<-locked)()
+
+	_, err = lockFile(filepath.Join(f, "missing", "filename.json"), true)
+	var e *errLock
+	assert.ErrorAs(t, err, &e)
+}
+
+func TestReadLock(t *testing.T) {
+	t.Run("Missing file", func(t *testing.T) {
+		f := filepath.Join(t.TempDir(), "filename.json")
+		unlock, err := readLock(f)
+		require.NoError(t, err)
+		unlock()
+		assert.NoFileExists(t, f+lockSuffix)
+	})
+	t.Run("Lock file not created", func(t *testing.T) {
+		f := filepath.Join(t.TempDir(), "filename.json")
+		require.NoError(t, os.WriteFile(f, []byte("{}"), 0644))
+		// Opening a folder for writing fails as in a read-only one
+		require.NoError(t, os.Mkdir(f+lockSuffix, 0755))
+		unlock, err := readLock(f)
+		require.NoError(t, err)
+		unlock()
+		var v interface{}
+		assert.NoError(t, loadJSON(f, &v))
+	})
+}
+
 func TestStorageDrop(t *testing.T) {
 	t.Run("Actually drop", func(t *testing.T) {
 		f := filepath.Join(t.TempDir(), "filename.json")
@@ -85,3 +166,40 @@ func TestStorageDrop(t *testing.T) {
 		assert.ErrorAs(t, err, &pe)
 	})
 }
+
+func TestStoredDataLibrary(t *testing.T) {
+	s := New("")
+	user := zotero.Library{Type: zotero.UserLibrary, ID: 1}
+	group := zotero.Library{Type: zotero.GroupLibrary, ID: 1}
+	s.Data.Libs = append(s.Data.Libs,
+		Library{Library: user, Items: []Item{{Key: "item1"}}},
+		Library{Library: group, Items: []Item{{Key: "item2"}, {Key: "item3"}}})
+	require.NotNil(t, s.Data.Library(group))
+	assert.Equal(t, "item2", s.Data.Library(group).Items[0].Key)
+	assert.Nil(t, s.Data.Library(zotero.Library{Type: zotero.GroupLibrary, ID: 2}))
+	assert.Equal(t, 3, s.Data.NumItems())
+}
+
+func TestLibraryCollections(t *testing.T) {
+	lib := Library{
+		Collections: []Collection{
+			{Key: "C1", Name: "Thesis"},
+			{Key: "C2", Name: "Related work", ParentKey: "C1"},
+			{Key: "C3", Name: "Fuzzing", ParentKey: "C2"},
+			{Key: "C4", Name: "Related work"},
+		},
+	}
+	assert.Equal(t, "Thesis/Related work/Fuzzing", lib.CollectionPath("C3"))
+	assert.Equal(t, "", lib.CollectionPath("missing"))
+	assert.Equal(t, map[string]bool{"C2": true, "C4": true}, lib.FindCollections("related work", false))
+	assert.Equal(t, map[string]bool{"C2": true}, lib.FindCollections("Thesis/Related work", false))
+	assert.Equal(t, map[string]bool{"C1": true, "C2": true, "C3": true}, lib.FindCollections("Thesis", true))
+	assert.Empty(t, lib.FindCollections("missing", true))
+}
+
+func TestItemField(t *testing.T) {
+	item := Item{Fields: map[string]string{"DOI": "10.1000/xyz", "date": "2021"}}
+	assert.Equal(t, "10.1000/xyz", item.Field("DOI"))
+	assert.Equal(t, "10.1000/xyz", item.Field("doi"))
+	assert.Equal(t, "", item.Field("volume"))
+}
@@ -0,0 +1,71 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NewSimplifier returns a transformer removing the accents and the other
+// diacritics, so that searches need not spell them. Transformers are not safe
+// for concurrent use.
+func NewSimplifier() transform.Transformer {
+	return transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)),
+		runes.Map(func(r rune) rune {
+			switch r {
+			case 'Ø':
+				return 'O'
+			case 'ø':
+				return 'o'
+			case 'Ł':
+				return 'L'
+			case 'ł':
+				return 'l'
+			default:
+				return r
+			}
+		}))
+}
+
+// Simplify removes the diacritics from s with tr
+func Simplify(tr transform.Transformer, s string) string {
+	simp, _, _ := transform.String(tr, s)
+	return simp
+}
+
+// OriginalSpan maps the span from start to end of the text that tr simplifies
+// s into back to the span of s it comes from. The span is widened to whole
+// characters of s, including the diacritics following its last one.
+func OriginalSpan(tr transform.Transformer, s string, start, end int) (int, int) {
+	origStart, origEnd := len(s), len(s)
+	pos := 0
+	for i := 0; i < len(s); {
+		_, width := utf8.DecodeRuneInString(s[i:])
+		n := 1
+		if s[i] >= utf8.RuneSelf {
+			n = len(Simplify(tr, s[i:i+width]))
+		}
+		if n > 0 {
+			if origStart == len(s) && pos+n > start {
+				origStart = i
+			}
+			if pos >= end {
+				origEnd = i
+				break
+			}
+		}
+		pos += n
+		i += width
+	}
+	if origStart > origEnd {
+		origStart = origEnd
+	}
+	return origStart, origEnd
+}
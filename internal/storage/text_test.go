@@ -0,0 +1,33 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginalSpan(t *testing.T) {
+	tr := NewSimplifier()
+	tests := []struct {
+		text, simp string
+		start, end int
+		exp        string
+	}{
+		{"Müller et al.", "Muller et al.", 0, 6, "Müller"},
+		{"Dr. Müller", "Dr. Muller", 4, 10, "Müller"},
+		{"Dr. Müller", "Dr. Muller", 5, 6, "ü"},
+		// Decomposed, the diacritic follows the letter
+		{"Mu\u0308ller", "Muller", 0, 2, "Mu\u0308"},
+		{"Łódź, 2021", "Lodz, 2021", 6, 10, "2021"},
+		{"ﬁnal", "final", 1, 3, "ﬁn"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.simp, Simplify(tr, test.text))
+		start, end := OriginalSpan(tr, test.text, test.start, test.end)
+		assert.Equal(t, test.exp, test.text[start:end])
+	}
+}
@@ -0,0 +1,44 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/acidghost/zotools/internal/files"
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+)
+
+// fetchFiles downloads all the attachments files that are missing or
+// outdated, reporting the ones that fail without stopping until ctx is done
+func fetchFiles(ctx context.Context, fetcher files.Fetcher, data *storage.StoredData) {
+	fetched, failed := 0, 0
+	for i := range data.Libs {
+		lib := &data.Libs[i]
+		for j := range lib.Items {
+			for k := range lib.Items[j].Attachments {
+				file := files.FromAttachment(lib.Library, &lib.Items[j].Attachments[k])
+				if file.Filename == "" || !file.Stored() {
+					continue
+				}
+				if ctx.Err() != nil {
+					fmt.Printf("Storage saved, files interrupted after checking %d attachments files, %d failed\n",
+						fetched+failed, failed)
+					return
+				}
+				_, err := fetcher.Fetch(ctx, file)
+				if err != nil {
+					utils.Eprintf("Failed to fetch attachment:\n - %v\n", err)
+					failed++
+				} else {
+					fetched++
+				}
+			}
+		}
+	}
+	fmt.Printf("Checked %d attachments files, %d failed\n", fetched+failed, failed)
+}
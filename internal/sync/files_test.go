@@ -0,0 +1,60 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package sync
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/files"
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	keys []string
+}
+
+func (s *fakeSource) FileContext(_ context.Context, _ zotero.Library, key string) (io.ReadCloser, error) {
+	s.keys = append(s.keys, key)
+	return io.NopCloser(strings.NewReader("content")), nil
+}
+
+func TestFetchFiles(t *testing.T) {
+	data := storage.StoredData{
+		Libs: []storage.Library{
+			{Items: []storage.Item{
+				{Key: "item1", Attachments: []storage.Attachment{
+					{Key: "A1", Filename: "a1.pdf"},
+					{Key: "A2"},
+				}},
+			}},
+		},
+	}
+	dir := t.TempDir()
+	src := &fakeSource{}
+	fetchFiles(context.Background(), files.NewAPI(src, dir), &data)
+	assert.Equal(t, []string{"A1"}, src.keys)
+	assert.FileExists(t, utils.MakePath(dir, "A1", "a1.pdf"))
+}
+
+func TestFetchFilesCancelled(t *testing.T) {
+	data := storage.StoredData{
+		Libs: []storage.Library{
+			{Items: []storage.Item{
+				{Key: "item1", Attachments: []storage.Attachment{{Key: "A1", Filename: "a1.pdf"}}},
+			}},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src := &fakeSource{}
+	fetchFiles(ctx, files.NewAPI(src, t.TempDir()), &data)
+	assert.Empty(t, src.keys)
+}
@@ -0,0 +1,78 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/zotero"
+)
+
+// Name of the file where Zotero desktop caches the text of an attachment
+const fulltextCacheFile = ".zotero-ft-cache"
+
+func syncFulltext(ctx context.Context, zot *zotero.Zotero, data *storage.StoredData,
+	fulltext *storage.Fulltext, zoteroDir string) {
+	for i := range data.Libs {
+		lib := &data.Libs[i]
+		since := fulltext.Data.Version(lib.Library)
+		versions, version, err := zot.FulltextVersionsContext(ctx, lib.Library, since)
+		if err != nil {
+			dieIfFulltextInterrupted(ctx)
+			utils.Die("Failed to load full-text versions:\n - %v\n", err)
+		}
+
+		for key := range versions {
+			text, err := readFulltext(ctx, zot, lib.Library, zoteroDir, key)
+			if err != nil {
+				dieIfFulltextInterrupted(ctx)
+				utils.Die("Failed to load full-text of %s:\n - %v\n", key, err)
+			}
+			fulltext.Data.SetText(lib.Library, key, text)
+		}
+
+		fulltext.Data.SetVersion(lib.Library, version)
+		fmt.Printf("Retrieved full-text of %d attachments in library %q\n", len(versions), lib.Name)
+	}
+
+	pruneFulltext(data, fulltext)
+}
+
+// readFulltext prefers the text cached by Zotero desktop next to the
+// attachment, falling back to the one indexed by the API
+func readFulltext(ctx context.Context, zot *zotero.Zotero, lib zotero.Library, zoteroDir,
+	key string) (string, error) {
+	if cached, err := os.ReadFile(utils.MakePath(zoteroDir, key, fulltextCacheFile)); err == nil {
+		return string(cached), nil
+	}
+	fulltext, err := zot.ItemFulltextContext(ctx, lib, key)
+	if err != nil || fulltext == nil {
+		return "", err
+	}
+	return fulltext.Content, nil
+}
+
+// pruneFulltext forgets the text of the attachments that are no longer in
+// any library
+func pruneFulltext(data *storage.StoredData, fulltext *storage.Fulltext) {
+	keys := make(map[string]bool)
+	for i := range data.Libs {
+		lib := &data.Libs[i]
+		for j := range lib.Items {
+			for _, attach := range lib.Items[j].Attachments {
+				keys[storage.FulltextKey(lib.Library, attach.Key)] = true
+			}
+		}
+	}
+	for key := range fulltext.Data.Content {
+		if !keys[key] {
+			delete(fulltext.Data.Content, key)
+		}
+	}
+}
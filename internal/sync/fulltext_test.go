@@ -0,0 +1,49 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFulltextCached(t *testing.T) {
+	dir := t.TempDir()
+	path := utils.MakePath(dir, "A1", fulltextCacheFile)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("cached text"), 0644))
+	// The API is never reached when Zotero has the text cached
+	text, err := readFulltext(context.Background(), nil, zotero.Library{}, dir, "A1")
+	require.NoError(t, err)
+	assert.Equal(t, "cached text", text)
+}
+
+func TestPruneFulltext(t *testing.T) {
+	user := zotero.Library{Type: zotero.UserLibrary, ID: 1}
+	group := zotero.Library{Type: zotero.GroupLibrary, ID: 1}
+	data := storage.StoredData{
+		Libs: []storage.Library{
+			{Library: user, Items: []storage.Item{
+				{Key: "item1", Attachments: []storage.Attachment{{Key: "A1"}}},
+			}},
+			{Library: group},
+		},
+	}
+	fulltext := storage.NewFulltext("")
+	fulltext.Data.SetText(user, "A1", "kept")
+	fulltext.Data.SetText(user, "A2", "deleted")
+	// Same key, but in another library
+	fulltext.Data.SetText(group, "A1", "deleted")
+	pruneFulltext(&data, &fulltext)
+	assert.Equal(t, map[string]string{"/users/1/A1": "kept"}, fulltext.Data.Content)
+}
@@ -0,0 +1,121 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+
+	"github.com/acidghost/zotools/internal/storage"
+)
+
+type digest [sha256.Size]byte
+
+// libraryChanges are the changes made to a library by the synchronization,
+// so that only those are written to the storage
+type libraryChanges struct {
+	lib *storage.Library
+	// Replaces the stored library altogether
+	fresh   bool
+	upsert  []storage.Item
+	deleted []string
+}
+
+func digestOf(item *storage.Item) digest {
+	//nolint:errcheck
+	serialized, _ := json.Marshal(item)
+	return sha256.Sum256(serialized)
+}
+
+// digests hashes the items of the library by key, to find out later which
+// ones changed
+func digests(lib *storage.Library) map[string]digest {
+	ds := make(map[string]digest, len(lib.Items))
+	for i := range lib.Items {
+		ds[lib.Items[i].Key] = digestOf(&lib.Items[i])
+	}
+	return ds
+}
+
+// changesOf compares the items of the library with their digests taken
+// before the synchronization
+func changesOf(lib *storage.Library, before map[string]digest, fresh bool) libraryChanges {
+	changes := libraryChanges{lib: lib, fresh: fresh}
+	seen := make(map[string]bool, len(lib.Items))
+	for i := range lib.Items {
+		item := &lib.Items[i]
+		seen[item.Key] = true
+		if d, exists := before[item.Key]; !exists || d != digestOf(item) {
+			changes.upsert = append(changes.upsert, *item)
+		}
+	}
+	for key := range before {
+		if !seen[key] {
+			changes.deleted = append(changes.deleted, key)
+		}
+	}
+	sort.Strings(changes.deleted)
+	return changes
+}
+
+// writeChanges stores the changes of the synchronized libraries, dropping
+// the libraries no longer reachable
+func writeChanges(tx storage.Tx, changes []libraryChanges) error {
+	reachable := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		reachable[c.lib.Prefix()] = true
+	}
+	stored, err := tx.Libraries()
+	if err != nil {
+		return err
+	}
+	for _, lib := range stored {
+		if !reachable[lib.Prefix()] {
+			if err := tx.DeleteLibrary(lib); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range changes {
+		if c.fresh {
+			if err := tx.DeleteLibrary(c.lib.Library); err != nil {
+				return err
+			}
+		}
+		if err := tx.PutLibrary(c.lib); err != nil {
+			return err
+		}
+		if err := tx.UpsertItems(c.lib.Library, c.upsert); err != nil {
+			return err
+		}
+		if err := tx.DeleteItems(c.lib.Library, c.deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIndex indexes the synchronized libraries for the searches, reusing
+// the index of those that did not change unless rebuilding everything
+func updateIndex(filename string, libs []storage.Library, rebuild bool) error {
+	previous := storage.NewIndex(filename)
+	if !rebuild {
+		// A missing or broken index is simply built again
+		//nolint:errcheck
+		previous.Load()
+	}
+	index := storage.NewIndex(filename)
+	for i := range libs {
+		lib := &libs[i]
+		if idx := previous.Data.Library(lib); idx != nil {
+			index.Data.Libs[lib.Prefix()] = idx
+		} else {
+			index.Data.SetLibrary(lib)
+		}
+	}
+	return index.Persist()
+}
@@ -0,0 +1,78 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package sync
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangesOf(t *testing.T) {
+	lib := storage.Library{Items: []storage.Item{{Key: "A1"}, {Key: "A2"}, {Key: "A3"}}}
+	before := digests(&lib)
+	lib.Items = []storage.Item{{Key: "A1"}, {Key: "A3", Title: "Changed"}, {Key: "A4"}}
+	changes := changesOf(&lib, before, false)
+	assert.Equal(t, []storage.Item{{Key: "A3", Title: "Changed"}, {Key: "A4"}}, changes.upsert)
+	assert.Equal(t, []string{"A2"}, changes.deleted)
+}
+
+func TestWriteChanges(t *testing.T) {
+	user := zotero.Library{Type: zotero.UserLibrary, ID: 1, Name: "Mine"}
+	group := zotero.Library{Type: zotero.GroupLibrary, ID: 2, Name: "Team"}
+	store, err := storage.Open(filepath.Join(t.TempDir(), "storage.db"), storage.BoltBackend)
+	require.NoError(t, err)
+	store.Data.Libs = []storage.Library{
+		{Library: user, Items: []storage.Item{{Key: "A1"}, {Key: "A2"}}},
+		{Library: group, Items: []storage.Item{{Key: "B1"}}},
+	}
+	require.NoError(t, store.Persist())
+
+	synced := storage.Library{Library: user, Version: 5, Items: []storage.Item{{Key: "A1"}, {Key: "A3"}}}
+	changes := []libraryChanges{{lib: &synced, upsert: []storage.Item{{Key: "A3"}}, deleted: []string{"A2"}}}
+	require.NoError(t, store.Update(func(tx storage.Tx) error { return writeChanges(tx, changes) }))
+	require.NoError(t, store.Load())
+	assert.Equal(t, []storage.Library{synced}, store.Data.Libs)
+
+	// Fresh libraries replace the stored ones
+	synced.Items = []storage.Item{{Key: "A9"}}
+	changes = []libraryChanges{{lib: &synced, fresh: true, upsert: synced.Items}}
+	require.NoError(t, store.Update(func(tx storage.Tx) error { return writeChanges(tx, changes) }))
+	require.NoError(t, store.Load())
+	assert.Equal(t, []storage.Library{synced}, store.Data.Libs)
+}
+
+func TestUpdateIndex(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "storage.index.json")
+	libs := []storage.Library{
+		{Library: zotero.Library{Type: zotero.UserLibrary, ID: 1}, Version: 3,
+			Items: []storage.Item{{Key: "A1", Title: "First title"}}},
+		{Library: zotero.Library{Type: zotero.GroupLibrary, ID: 2}, Version: 5},
+	}
+	libs[0].Items[0].Fold(storage.NewSimplifier())
+	require.NoError(t, updateIndex(f, libs, false))
+
+	// Unchanged libraries keep their index, even if their items differ here
+	libs[0].Items[0].Title = "Other"
+	libs[0].Items[0].Fold(storage.NewSimplifier())
+	libs[1].Version = 6
+	libs[1].Items = []storage.Item{{Key: "B1", Title: "Second title"}}
+	libs[1].Items[0].Fold(storage.NewSimplifier())
+	require.NoError(t, updateIndex(f, libs, false))
+	index := storage.NewIndex(f)
+	require.NoError(t, index.Load())
+	assert.Len(t, index.Data.Libs, 2)
+	title := []string{"tit"}
+	assert.Equal(t, map[string]bool{"A1": true}, index.Data.Library(&libs[0]).Candidates(title, storage.TitleScope))
+	assert.Equal(t, map[string]bool{"B1": true}, index.Data.Library(&libs[1]).Candidates(title, storage.TitleScope))
+
+	require.NoError(t, updateIndex(f, libs[:1], true))
+	require.NoError(t, index.Load())
+	assert.Empty(t, index.Data.Library(&libs[0]).Candidates(title, storage.TitleScope))
+}
@@ -5,40 +5,62 @@
 package sync
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
+	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/files"
 	"github.com/acidghost/zotools/internal/storage"
 	"github.com/acidghost/zotools/internal/utils"
 	"github.com/acidghost/zotools/internal/zotero"
+	"golang.org/x/text/transform"
 )
 
 const syncUsageTop = " " + utils.OptionsUsage
 
+const (
+	noteType       = "note"
+	attachmentType = "attachment"
+)
+
 type Command struct {
-	fs       *flag.FlagSet
-	flagDrop *bool
+	fs           *flag.FlagSet
+	flagDrop     *bool
+	flagFulltext *bool
+	flagFiles    *bool
+	flagPar      *uint
+	flagTimeout  *time.Duration
 }
 
 func New(cmd, banner string) *Command {
 	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
 	flagDrop := fs.Bool("drop", false, "delete storage and start fresh")
+	flagFulltext := fs.Bool("fulltext", false, "synchronize also the full-text content of the attachments")
+	flagFiles := fs.Bool("files", false, "download the attachments files missing from the Zotero directory")
+	flagPar := fs.Uint("j", 4, "number of concurrent requests when fetching the items")
+	flagTimeout := fs.Duration("timeout", 0, "give up the whole synchronization after this long (e.g. 10m)")
 	fs.Usage = utils.MakeUsage(fs, cmd, banner, syncUsageTop, "")
-	return &Command{fs, flagDrop}
+	return &Command{fs, flagDrop, flagFulltext, flagFiles, flagPar, flagTimeout}
 }
 
 func (c *Command) Run(args []string, conf config.Config) {
 	//nolint:errcheck
 	c.fs.Parse(args)
 
-	exists := true
-	if _, err := os.Stat(conf.Storage); err != nil && os.IsNotExist(err) {
-		exists = false
+	exists := fileExists(conf.Storage)
+	store, err := storage.FromConfig(conf)
+	if err != nil {
+		utils.Die("Failed to open the local storage:\n - %v\n", err)
 	}
-
-	store := storage.New(conf.Storage)
 	if *c.flagDrop && exists {
 		if err := store.Drop(); err != nil {
 			utils.Die("Failed to drop storage:\n - %v\n", err)
@@ -49,78 +71,613 @@ func (c *Command) Run(args []string, conf config.Config) {
 		}
 	}
 
-	zot, err := zotero.New(conf.Key)
+	// Nothing is persisted until the libraries are completely merged, so an
+	// interruption leaves the storage as it was
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *c.flagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *c.flagTimeout)
+		defer cancel()
+	}
+
+	opts := conf.ZoteroOptions()
+	opts.Jobs = *c.flagPar
+	zot, err := zotero.NewContext(ctx, conf.Key, opts)
 	if err != nil {
+		dieIfInterrupted(ctx)
+		var statusErr *zotero.ErrWrongStatus
+		if errors.As(err, &statusErr) && statusErr.Status() == http.StatusForbidden {
+			utils.Die("Zotero rejected the API key (%s), check the key in the configuration\n",
+				statusErr.Body())
+		}
 		utils.Die("Failed to initialize Zotero API:\n - %v\n", err)
 	}
 
-	if store.Data.Lib.Version == 0 {
-		// Initial sync queries all the items
-		items, err := zot.AllItems()
-		if err != nil {
-			utils.Die("Failed to load items:\n - %v\n", err)
+	libs, err := zot.LibrariesContext(ctx)
+	if err != nil {
+		dieIfInterrupted(ctx)
+		utils.Die("Failed to list libraries:\n - %v\n", err)
+	}
+	// Likely a key that lost its permissions, better not wipe the storage
+	if len(libs) == 0 && len(store.Data.Libs) > 0 {
+		utils.Die("The API key cannot read any library, refusing to drop the %d stored ones "+
+			"(use -drop to do so)\n", len(store.Data.Libs))
+	}
+
+	// Find out before synchronizing if the attachments cannot be downloaded
+	if *c.flagFiles && conf.WebDAV == nil {
+		for _, lib := range libs {
+			if err := zot.Check(lib, zotero.ReadFiles); err != nil {
+				utils.Die("Failed to download attachments:\n - %v\n", err)
+			}
+		}
+	}
+
+	synced := make([]storage.Library, len(libs))
+	changes := make([]libraryChanges, 0, len(libs))
+	// Libraries no longer reachable are dropped, and data upgraded from an
+	// older schema is written back even if nothing changed on Zotero
+	modified := len(store.Data.Libs) != len(libs) || store.Data.Migrated()
+	for i, lib := range libs {
+		stored := store.Data.Library(lib)
+		fresh := stored == nil || stored.NeedsResync()
+		if fresh {
+			// Fetched from scratch, e.g. after an upgrade of the storage
+			stored = &storage.Library{Library: lib, Items: []storage.Item{}}
+		}
+		before := digests(stored)
+		modified = modified || stored.Name != lib.Name
+		stored.Name = lib.Name
+		if syncLibrary(ctx, zot, stored) {
+			modified = true
 		}
+		synced[i] = *stored
+		changes = append(changes, changesOf(&synced[i], before, fresh))
+	}
 
-		initSync(&store, items)
-		fmt.Printf("Retrieved %d top level items\n", len(store.Data.Lib.Items))
+	dieIfInterrupted(ctx)
 
-		if err := store.Persist(); err != nil {
+	if modified {
+		// Only the changed items are written, libraries no longer reachable
+		// with this key are dropped from the storage
+		err = store.Update(func(tx storage.Tx) error { return writeChanges(tx, changes) })
+		if err != nil {
 			utils.Die("Failed to persist library:\n - %v\n", err)
 		}
+		store.Data.Libs = synced
 
 		println("Library persisted!")
-	} else {
-		// TODO: code me
-		println("Synchronizing an existing library is not supported yet")
 	}
+
+	// The index is built as well after upgrading from a version without it
+	indexFilename := storage.IndexFilename(conf.Storage)
+	if modified || !fileExists(indexFilename) {
+		if err := updateIndex(indexFilename, synced, *c.flagDrop); err != nil {
+			utils.Die("Failed to persist the search index:\n - %v\n", err)
+		}
+	}
+
+	fulltext := storage.NewFulltext(storage.FulltextFilename(conf.Storage))
+	ftExists := fileExists(storage.FulltextFilename(conf.Storage))
+	if *c.flagDrop && ftExists {
+		if err := fulltext.Drop(); err != nil {
+			utils.Die("Failed to drop full-text storage:\n - %v\n", err)
+		}
+	} else if ftExists {
+		if err := fulltext.Load(); err != nil {
+			utils.Die("Failed to load the full-text storage:\n - %v\n", err)
+		}
+	}
+
+	if *c.flagFulltext {
+		syncFulltext(ctx, zot, &store.Data, &fulltext, conf.Zotero)
+		dieIfFulltextInterrupted(ctx)
+
+		if err := fulltext.Persist(); err != nil {
+			utils.Die("Failed to persist full-text:\n - %v\n", err)
+		}
+
+		println("Full-text persisted!")
+	}
+
+	if *c.flagFiles {
+		var fetcher files.Fetcher = files.NewAPI(zot, conf.Zotero)
+		if conf.WebDAV != nil {
+			if fetcher, err = files.FromConfig(ctx, conf); err != nil {
+				utils.Die("Failed to initialize attachments download:\n - %v\n", err)
+			}
+		}
+		fetchFiles(ctx, fetcher, &store.Data)
+	}
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil || !os.IsNotExist(err)
+}
+
+// dieIfInterrupted quits when the synchronization was interrupted or timed out
+func dieIfInterrupted(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		utils.Die("Synchronization interrupted, storage left untouched:\n - %v\n", err)
+	}
+}
+
+// dieIfFulltextInterrupted quits when the synchronization of the full-text,
+// which comes after the storage is saved, was interrupted or timed out
+func dieIfFulltextInterrupted(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		utils.Die("Full-text synchronization interrupted, storage saved but full-text left untouched:\n - %v\n",
+			err)
+	}
+}
+
+// syncLibrary merges the changes made to the library on Zotero, reporting
+// whether there were any
+func syncLibrary(ctx context.Context, zot *zotero.Zotero, lib *storage.Library) bool {
+	fmt.Printf("Synchronizing library %q\n", lib.Name)
+	if err := zot.Check(lib.Library, zotero.ReadNotes); err != nil {
+		utils.Eprintf("Warning: %v, notes will be missing\n", err)
+	}
+
+	// Only query the items modified since our last sync, merging them while
+	// they are received; nothing is persisted if something fails later on
+	since := lib.Version
+	merger := newItemsMerger(lib)
+	version, err := zot.EachItemContext(ctx, lib.Library, since, func(item *zotero.Item) error {
+		merger.merge(item)
+		return nil
+	})
+	var notModified *zotero.ErrNotModified
+	if errors.As(err, &notModified) {
+		fmt.Printf("Library %q is up to date\n", lib.Name)
+		return false
+	} else if err != nil {
+		dieIfInterrupted(ctx)
+		utils.Die("Failed to load items:\n - %v\n", err)
+	}
+
+	colls, err := zot.AllCollectionsContext(ctx, lib.Library, since)
+	if err != nil {
+		dieIfInterrupted(ctx)
+		utils.Die("Failed to load collections:\n - %v\n", err)
+	}
+
+	merger.finish(version)
+	if merger.orphans > 0 {
+		utils.Eprintf("Warning: %d attachments and notes belong to missing items, kept as standalone\n",
+			merger.orphans)
+	}
+	mergeCollections(lib, colls)
+	if since == 0 {
+		fmt.Printf("Retrieved %d top level items and %d collections\n",
+			len(lib.Items), len(lib.Collections))
+		return true
+	}
+
+	fmt.Printf("Retrieved %d updated items since version %d\n", len(merger.merged), since)
+
+	deleted, err := zot.DeletedContext(ctx, lib.Library, since)
+	if err != nil {
+		dieIfInterrupted(ctx)
+		utils.Die("Failed to load deleted objects:\n - %v\n", err)
+	}
+
+	removed := removeItems(lib, deleted.Items)
+	removedColls := removeCollections(lib, deleted.Collections)
+	removeTags(lib, deleted.Tags)
+	fmt.Printf("Removed %d deleted items, %d collections and %d tags\n",
+		removed, removedColls, len(deleted.Tags))
+	return true
+}
+
+func tagNames(tags []zotero.Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Tag)
+	}
+	return names
+}
+
+// removeTags strips the tags with the given names from all the items
+func removeTags(lib *storage.Library, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	toRemove := make(map[string]bool, len(names))
+	for _, name := range names {
+		toRemove[name] = true
+	}
+
+	for i := range lib.Items {
+		item := &lib.Items[i]
+		tags := item.Tags[:0]
+		for _, tag := range item.Tags {
+			if !toRemove[tag] {
+				tags = append(tags, tag)
+			}
+		}
+		item.Tags = tags
+	}
+}
+
+// mergeCollections updates the stored collections of the library with the
+// given ones, replacing the ones already present by key.
+func mergeCollections(lib *storage.Library, colls zotero.CollectionsResult) {
+	trashed := make([]string, 0)
+	for i := range colls.Collections {
+		coll := &colls.Collections[i]
+		if coll.Data.Deleted {
+			trashed = append(trashed, coll.Key)
+			continue
+		}
+		updated := storage.Collection{
+			Key:       coll.Key,
+			Version:   coll.Version,
+			Name:      coll.Data.Name,
+			ParentKey: string(coll.Data.ParentKey),
+		}
+		if stored := lib.Collection(coll.Key); stored != nil {
+			*stored = updated
+		} else {
+			lib.Collections = append(lib.Collections, updated)
+		}
+	}
+	removeCollections(lib, trashed)
+}
+
+// removeCollections deletes the collections with the given keys and removes
+// them from the memberships of the items. It returns the number of
+// collections removed.
+func removeCollections(lib *storage.Library, keys []string) int {
+	if len(keys) == 0 {
+		return 0
+	}
+
+	toRemove := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		toRemove[key] = true
+	}
+
+	kept := lib.Collections[:0]
+	for _, coll := range lib.Collections {
+		if !toRemove[coll.Key] {
+			kept = append(kept, coll)
+		}
+	}
+	removed := len(lib.Collections) - len(kept)
+	lib.Collections = kept
+
+	for i := range lib.Items {
+		item := &lib.Items[i]
+		memberships := item.Collections[:0]
+		for _, key := range item.Collections {
+			if !toRemove[key] {
+				memberships = append(memberships, key)
+			}
+		}
+		item.Collections = memberships
+	}
+	return removed
+}
+
+// itemsMerger merges the items into the stored library one at a time, as
+// they are received
+type itemsMerger struct {
+	lib      *storage.Library
+	byKey    map[string]int
+	parentOf map[string]string
+	trashed  map[string]bool
+	// Items created to hold children whose parent was not received yet
+	placeholders map[string]bool
+	// Keys of the items merged, which may be received more than once if the
+	// library changes while they are fetched
+	merged map[string]bool
+	// Children whose parent never arrived, kept as standalone items
+	orphans int
+	// Computes the searchable text of the items
+	tr transform.Transformer
+}
+
+func newItemsMerger(lib *storage.Library) *itemsMerger {
+	m := &itemsMerger{
+		lib:          lib,
+		byKey:        make(map[string]int, len(lib.Items)),
+		parentOf:     make(map[string]string),
+		trashed:      make(map[string]bool),
+		placeholders: make(map[string]bool),
+		merged:       make(map[string]bool),
+		tr:           storage.NewSimplifier(),
+	}
+	for i := range lib.Items {
+		m.byKey[lib.Items[i].Key] = i
+		for _, attach := range lib.Items[i].Attachments {
+			m.parentOf[attach.Key] = lib.Items[i].Key
+		}
+		for _, note := range lib.Items[i].Notes {
+			m.parentOf[note.Key] = lib.Items[i].Key
+		}
+	}
+	return m
+}
+
+// lookup returns the index of the item with the given key, creating a
+// placeholder if not present yet
+func (m *itemsMerger) lookup(key string) int {
+	if i, exists := m.byKey[key]; exists {
+		return i
+	}
+	m.lib.Items = append(m.lib.Items, storage.Item{
+		Key:         key,
+		Attachments: []storage.Attachment{},
+	})
+	m.byKey[key] = len(m.lib.Items) - 1
+	m.placeholders[key] = true
+	return len(m.lib.Items) - 1
 }
 
-func initSync(store *storage.Storage, items zotero.ItemsResult) {
-	byKey := make(map[string]storage.Item)
-	for i := range items.Items {
-		item := &items.Items[i]
-		if item.Data.ParentKey != "" {
-			attach := storage.Attachment{
-				Key:         item.Key,
-				Version:     item.Version,
-				ContentType: item.Data.ContentType,
-				Filename:    item.Data.Filename,
+func (m *itemsMerger) merge(item *zotero.Item) {
+	m.merged[item.Key] = true
+	lib := m.lib
+	// Items in the trash are removed once all the others are merged
+	if item.Data.Deleted {
+		m.trashed[item.Key] = true
+		return
+	}
+	delete(m.trashed, item.Key)
+
+	// Standalone attachments and notes are their own parent
+	parentKey := item.Data.ParentKey
+	if parentKey == "" {
+		parentKey = item.Key
+	}
+	if oldParent, exists := m.parentOf[item.Key]; exists && oldParent != parentKey {
+		m.detach(oldParent, item.Key)
+	}
+
+	if item.Data.ParentKey == "" {
+		stored := &lib.Items[m.lookup(item.Key)]
+		delete(m.placeholders, item.Key)
+		stored.Version = item.Version
+		stored.Title = item.Data.Title
+		stored.Abstract = item.Data.Abstract
+		stored.ItemType = item.Data.ItemType
+		stored.Creators = item.Data.Creators
+		stored.Collections = item.Data.Collections
+		stored.Tags = tagNames(item.Data.Tags)
+		stored.Fields = fieldsOf(item)
+		switch item.Data.ItemType {
+		case noteType:
+			// Standalone notes have no title, Zotero shows their first line
+			note := storage.Note{Key: item.Key, Version: item.Version, Text: noteText(item.Data.Note)}
+			stored.Title = strings.SplitN(note.Text, "\n", 2)[0]
+			stored.Notes = []storage.Note{note}
+			m.parentOf[item.Key] = item.Key
+		case attachmentType:
+			// Standalone attachments are listed as their own attachment to
+			// make them actionable
+			if stored.Title == "" {
+				stored.Title = item.Data.Filename
 			}
-			if parent, exists := byKey[item.Data.ParentKey]; exists {
-				parent.Attachments = append(parent.Attachments, attach)
-				byKey[item.Data.ParentKey] = parent
+			stored.Attachments = []storage.Attachment{attachmentOf(item)}
+			m.parentOf[item.Key] = item.Key
+		}
+		stored.Fold(m.tr)
+		return
+	}
+
+	parent := &lib.Items[m.lookup(item.Data.ParentKey)]
+	m.parentOf[item.Key] = item.Data.ParentKey
+	if item.Data.ItemType == noteType {
+		upsertNote(parent, storage.Note{
+			Key:     item.Key,
+			Version: item.Version,
+			Text:    noteText(item.Data.Note),
+		})
+	} else {
+		upsertAttachment(parent, attachmentOf(item))
+	}
+}
+
+// fieldsOf returns the metadata of the item, with the URL of the regular items
+// that is decoded apart since attachments have one too
+func fieldsOf(item *zotero.Item) map[string]string {
+	if item.Data.URL == "" || item.Data.ItemType == attachmentType {
+		return item.Data.Fields
+	}
+	fields := make(map[string]string, len(item.Data.Fields)+1)
+	for name, value := range item.Data.Fields {
+		fields[name] = value
+	}
+	fields["url"] = item.Data.URL
+	return fields
+}
+
+func attachmentOf(item *zotero.Item) storage.Attachment {
+	return storage.Attachment{
+		Key:         item.Key,
+		Version:     item.Version,
+		ContentType: item.Data.ContentType,
+		Filename:    item.Data.Filename,
+		MD5:         item.Data.MD5,
+		MTime:       item.Data.MTime,
+		LinkMode:    item.Data.LinkMode,
+		Path:        item.Data.Path,
+		URL:         item.Data.URL,
+	}
+}
+
+// detach removes the child with the given key from its old parent. A child
+// that was standalone leaves behind an empty placeholder.
+func (m *itemsMerger) detach(parentKey, key string) {
+	parent := &m.lib.Items[m.byKey[parentKey]]
+	if parentKey != key {
+		removeChild(parent, key)
+		return
+	}
+	*parent = storage.Item{Key: key, Attachments: []storage.Attachment{}}
+	m.placeholders[key] = true
+}
+
+// finish removes the trashed items, turns the children whose parent never
+// arrived into standalone items and sets the version of the library
+func (m *itemsMerger) finish(version uint) {
+	trashed := make([]string, 0, len(m.trashed))
+	for key := range m.trashed {
+		trashed = append(trashed, key)
+	}
+	removeItems(m.lib, trashed)
+	m.orphans = adoptOrphans(m.lib, m.placeholders, m.tr)
+	m.lib.Version = version
+}
+
+// adoptOrphans replaces the placeholders, and the items without a key left by
+// older versions, with their children as standalone items. It returns the
+// number of children adopted.
+func adoptOrphans(lib *storage.Library, placeholders map[string]bool, tr transform.Transformer) int {
+	adopted := 0
+	kept := make([]storage.Item, 0, len(lib.Items))
+	for i := range lib.Items {
+		item := &lib.Items[i]
+		if item.Key != "" && !placeholders[item.Key] {
+			kept = append(kept, *item)
+			continue
+		}
+		for _, attach := range item.Attachments {
+			kept = append(kept, storage.Item{
+				Key:         attach.Key,
+				Version:     attach.Version,
+				Title:       attachmentTitle(&attach),
+				ItemType:    attachmentType,
+				Attachments: []storage.Attachment{attach},
+			})
+			kept[len(kept)-1].Fold(tr)
+			adopted++
+		}
+		for _, note := range item.Notes {
+			kept = append(kept, storage.Item{
+				Key:         note.Key,
+				Version:     note.Version,
+				Title:       strings.SplitN(note.Text, "\n", 2)[0],
+				ItemType:    noteType,
+				Attachments: []storage.Attachment{},
+				Notes:       []storage.Note{note},
+			})
+			kept[len(kept)-1].Fold(tr)
+			adopted++
+		}
+	}
+	lib.Items = kept
+	return adopted
+}
+
+// attachmentTitle names an adopted attachment by what identifies it, since
+// linked URLs and some snapshots have no filename
+func attachmentTitle(attach *storage.Attachment) string {
+	for _, title := range []string{attach.Filename, attach.URL, attach.Path} {
+		if title != "" {
+			return title
+		}
+	}
+	return attach.Key
+}
+
+// removeItems deletes from the library the items and attachments with the
+// given keys, together with the attachments and notes of the deleted items. It returns
+// the number of entries removed.
+func removeItems(lib *storage.Library, keys []string) int {
+	if len(keys) == 0 {
+		return 0
+	}
+
+	toRemove := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		toRemove[key] = true
+	}
+
+	removed := 0
+	kept := lib.Items[:0]
+	for _, item := range lib.Items {
+		if toRemove[item.Key] {
+			removed++
+			continue
+		}
+		attachments := item.Attachments[:0]
+		for _, attach := range item.Attachments {
+			if toRemove[attach.Key] {
+				removed++
 			} else {
-				byKey[item.Data.ParentKey] = storage.Item{
-					Attachments: []storage.Attachment{attach},
-				}
+				attachments = append(attachments, attach)
 			}
-		} else {
-			if existing, exists := byKey[item.Key]; exists {
-				// Already present, only attachments
-				byKey[item.Key] = storage.Item{
-					Key:         item.Key,
-					Version:     item.Version,
-					Title:       item.Data.Title,
-					Abstract:    item.Data.Abstract,
-					Creators:    item.Data.Creators,
-					Attachments: existing.Attachments,
-				}
+		}
+		item.Attachments = attachments
+		notes := item.Notes[:0]
+		for _, note := range item.Notes {
+			if toRemove[note.Key] {
+				removed++
 			} else {
-				byKey[item.Key] = storage.Item{
-					Key:         item.Key,
-					Version:     item.Version,
-					Title:       item.Data.Title,
-					Abstract:    item.Data.Abstract,
-					Creators:    item.Data.Creators,
-					Attachments: []storage.Attachment{},
-				}
+				notes = append(notes, note)
 			}
 		}
+		item.Notes = notes
+		kept = append(kept, item)
+	}
+	lib.Items = kept
+	return removed
+}
+
+func upsertAttachment(item *storage.Item, attach storage.Attachment) {
+	for i := range item.Attachments {
+		if item.Attachments[i].Key == attach.Key {
+			item.Attachments[i] = attach
+			return
+		}
+	}
+	item.Attachments = append(item.Attachments, attach)
+}
+
+func upsertNote(item *storage.Item, note storage.Note) {
+	for i := range item.Notes {
+		if item.Notes[i].Key == note.Key {
+			item.Notes[i] = note
+			return
+		}
 	}
+	item.Notes = append(item.Notes, note)
+}
 
-	store.Data.Lib.Version = items.Version
-	store.Data.Lib.Items = make([]storage.Item, 0, len(byKey))
-	for _, item := range byKey {
-		store.Data.Lib.Items = append(store.Data.Lib.Items, item)
+// removeChild removes the attachment or note with the given key from item
+func removeChild(item *storage.Item, key string) {
+	for i := range item.Attachments {
+		if item.Attachments[i].Key == key {
+			item.Attachments = append(item.Attachments[:i], item.Attachments[i+1:]...)
+			return
+		}
+	}
+	for i := range item.Notes {
+		if item.Notes[i].Key == key {
+			item.Notes = append(item.Notes[:i], item.Notes[i+1:]...)
+			return
+		}
 	}
 }
+
+var (
+	reBlockTag  = regexp.MustCompile(`(?i)<(br|/p|/div|/h[1-6]|/li|/tr)\b[^>]*>`)
+	reTag       = regexp.MustCompile(`<[^>]*>`)
+	reBlankLine = regexp.MustCompile(`[ \t]*\n[\s]*`)
+	reSpaces    = regexp.MustCompile(`[ \t]+`)
+)
+
+// noteText converts the HTML of a note to plain text, keeping one line for
+// each paragraph
+func noteText(note string) string {
+	text := reBlockTag.ReplaceAllString(note, "\n")
+	text = reTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = reSpaces.ReplaceAllString(text, " ")
+	text = reBlankLine.ReplaceAllString(text, "\n")
+	return strings.TrimSpace(text)
+}
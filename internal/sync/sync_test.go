@@ -10,10 +10,26 @@ import (
 	"github.com/acidghost/zotools/internal/storage"
 	"github.com/acidghost/zotools/internal/zotero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+type itemsResult struct {
+	Items   []zotero.Item
+	Version uint
+}
+
+// mergeAll merges the items one at a time, as syncLibrary does while they are
+// received
+func mergeAll(lib *storage.Library, res itemsResult) {
+	m := newItemsMerger(lib)
+	for i := range res.Items {
+		m.merge(&res.Items[i])
+	}
+	m.finish(res.Version)
+}
+
 func TestInitSync(t *testing.T) {
-	itemsRes := zotero.ItemsResult{
+	itemsRes := itemsResult{
 		Version: 1337,
 		Items: []zotero.Item{
 			{
@@ -34,15 +50,15 @@ func TestInitSync(t *testing.T) {
 			},
 		},
 	}
-	s := storage.New("")
-	initSync(&s, itemsRes)
-	assert.Equal(t, s.Data.Lib.Version, uint(1337))
-	assert.Equal(t, s.Data.Lib.Items[0].Key, "item1")
-	assert.Equal(t, s.Data.Lib.Items[0].Attachments[0].Key, "item2")
+	var lib storage.Library
+	mergeAll(&lib, itemsRes)
+	assert.Equal(t, lib.Version, uint(1337))
+	assert.Equal(t, lib.Items[0].Key, "item1")
+	assert.Equal(t, lib.Items[0].Attachments[0].Key, "item2")
 }
 
 func TestInitSyncInv(t *testing.T) {
-	itemsRes := zotero.ItemsResult{
+	itemsRes := itemsResult{
 		Version: 1337,
 		Items: []zotero.Item{
 			{
@@ -63,15 +79,15 @@ func TestInitSyncInv(t *testing.T) {
 			},
 		},
 	}
-	s := storage.New("")
-	initSync(&s, itemsRes)
-	assert.Equal(t, s.Data.Lib.Version, uint(1337))
-	assert.Equal(t, s.Data.Lib.Items[0].Key, "item1")
-	assert.Equal(t, s.Data.Lib.Items[0].Attachments[0].Key, "item2")
+	var lib storage.Library
+	mergeAll(&lib, itemsRes)
+	assert.Equal(t, lib.Version, uint(1337))
+	assert.Equal(t, lib.Items[0].Key, "item1")
+	assert.Equal(t, lib.Items[0].Attachments[0].Key, "item2")
 }
 
 func TestInitSyncMultiAttach(t *testing.T) {
-	itemsRes := zotero.ItemsResult{
+	itemsRes := itemsResult{
 		Version: 1337,
 		Items: []zotero.Item{
 			{
@@ -100,9 +116,309 @@ func TestInitSyncMultiAttach(t *testing.T) {
 			},
 		},
 	}
-	s := storage.New("")
-	initSync(&s, itemsRes)
-	assert.Equal(t, s.Data.Lib.Items[0].Key, "item1")
-	assert.Equal(t, s.Data.Lib.Items[0].Attachments[0].Key, "item2")
-	assert.Equal(t, s.Data.Lib.Items[0].Attachments[1].Key, "item3")
+	var lib storage.Library
+	mergeAll(&lib, itemsRes)
+	assert.Equal(t, lib.Items[0].Key, "item1")
+	assert.Equal(t, lib.Items[0].Attachments[0].Key, "item2")
+	assert.Equal(t, lib.Items[0].Attachments[1].Key, "item3")
+}
+
+func TestMergeItemsUpdate(t *testing.T) {
+	lib := storage.Library{
+		Version: 1337,
+		Items: []storage.Item{
+			{
+				Key:     "item1",
+				Version: 1,
+				Title:   "title item1",
+				Attachments: []storage.Attachment{
+					{Key: "item3", Version: 1, Filename: "item3.pdf"},
+				},
+			},
+			{
+				Key:         "item2",
+				Version:     1,
+				Title:       "title item2",
+				Attachments: []storage.Attachment{},
+			},
+		},
+	}
+	itemsRes := itemsResult{
+		Version: 1400,
+		Items: []zotero.Item{
+			{
+				Key:     "item1",
+				Version: 1400,
+				Data:    zotero.ItemData{Title: "new title item1"},
+			},
+			{
+				Key:     "item3",
+				Version: 1400,
+				Data: zotero.ItemData{
+					Filename:  "new item3.pdf",
+					ParentKey: "item2",
+				},
+			},
+			{
+				Key:     "item4",
+				Version: 1400,
+				Data: zotero.ItemData{
+					Title:  "title item4",
+					URL:    "https://example.com",
+					Tags:   []zotero.Tag{{Tag: "to-read"}, {Tag: "auto", Type: 1}},
+					Fields: map[string]string{"date": "2021"},
+				},
+			},
+		},
+	}
+	mergeAll(&lib, itemsRes)
+	assert.Equal(t, uint(1400), lib.Version)
+	require.Len(t, lib.Items, 3)
+	assert.Equal(t, "new title item1", lib.Items[0].Title)
+	assert.Equal(t, uint(1400), lib.Items[0].Version)
+	assert.Empty(t, lib.Items[0].Attachments)
+	require.Len(t, lib.Items[1].Attachments, 1)
+	assert.Equal(t, "new item3.pdf", lib.Items[1].Attachments[0].Filename)
+	assert.Equal(t, "item4", lib.Items[2].Key)
+	assert.Equal(t, []string{"to-read", "auto"}, lib.Items[2].Tags)
+	assert.Equal(t, "2021", lib.Items[2].Field("date"))
+	assert.Equal(t, "https://example.com", lib.Items[2].Field("url"))
+}
+
+func TestMergeItemsTrashed(t *testing.T) {
+	var lib storage.Library
+	lib.Items = []storage.Item{
+		{
+			Key:         "item1",
+			Attachments: []storage.Attachment{{Key: "item2"}, {Key: "item3"}},
+		},
+	}
+	itemsRes := itemsResult{
+		Version: 1400,
+		Items: []zotero.Item{
+			{
+				Key:  "item2",
+				Data: zotero.ItemData{ParentKey: "item1", Deleted: true},
+			},
+		},
+	}
+	mergeAll(&lib, itemsRes)
+	require.Len(t, lib.Items, 1)
+	require.Len(t, lib.Items[0].Attachments, 1)
+	assert.Equal(t, "item3", lib.Items[0].Attachments[0].Key)
+}
+
+func TestItemsMergerRestored(t *testing.T) {
+	var lib storage.Library
+	m := newItemsMerger(&lib)
+	m.merge(&zotero.Item{Key: "item1", Version: 1, Data: zotero.ItemData{Title: "Old", Deleted: true}})
+	m.merge(&zotero.Item{Key: "item2", Version: 1, Data: zotero.ItemData{Deleted: true}})
+	// Seen again after the library changed during the sync
+	m.merge(&zotero.Item{Key: "item1", Version: 2, Data: zotero.ItemData{Title: "New"}})
+	m.finish(2)
+	require.Len(t, lib.Items, 1)
+	assert.Equal(t, "New", lib.Items[0].Title)
+	assert.Equal(t, uint(2), lib.Version)
+	assert.Len(t, m.merged, 2)
+}
+
+func TestMergeItemsStandaloneAttachment(t *testing.T) {
+	var lib storage.Library
+	mergeAll(&lib, itemsResult{Version: 10, Items: []zotero.Item{
+		{Key: "A1", Version: 3, Data: zotero.ItemData{
+			ItemType: "attachment", Filename: "paper.pdf", ContentType: "application/pdf"}},
+	}})
+	require.Len(t, lib.Items, 1)
+	item := lib.Items[0]
+	assert.Equal(t, "A1", item.Key)
+	assert.Equal(t, "paper.pdf", item.Title)
+	assert.Equal(t, []storage.Attachment{
+		{Key: "A1", Version: 3, ContentType: "application/pdf", Filename: "paper.pdf"},
+	}, item.Attachments)
+
+	// Moved under a regular item
+	mergeAll(&lib, itemsResult{Version: 11, Items: []zotero.Item{
+		{Key: "item1", Data: zotero.ItemData{Title: "Paper", ItemType: "journalArticle"}},
+		{Key: "A1", Version: 4, Data: zotero.ItemData{
+			ItemType: "attachment", ParentKey: "item1", Filename: "paper.pdf"}},
+	}})
+	require.Len(t, lib.Items, 1)
+	assert.Equal(t, "item1", lib.Items[0].Key)
+	require.Len(t, lib.Items[0].Attachments, 1)
+	assert.Equal(t, "A1", lib.Items[0].Attachments[0].Key)
+
+	// And back to standalone
+	mergeAll(&lib, itemsResult{Version: 12, Items: []zotero.Item{
+		{Key: "A1", Version: 5, Data: zotero.ItemData{ItemType: "attachment", Filename: "paper.pdf"}},
+	}})
+	require.Len(t, lib.Items, 2)
+	assert.Empty(t, lib.Items[0].Attachments)
+	assert.Equal(t, "A1", lib.Items[1].Key)
+	assert.Len(t, lib.Items[1].Attachments, 1)
+}
+
+func TestMergeItemsOrphans(t *testing.T) {
+	lib := storage.Library{Items: []storage.Item{
+		// Left by older versions for a missing parent
+		{Notes: []storage.Note{{Key: "N1", Text: "Old orphan\nnote"}}},
+	}}
+	m := newItemsMerger(&lib)
+	m.merge(&zotero.Item{Key: "A1", Data: zotero.ItemData{ParentKey: "missing", Filename: "a.pdf"}})
+	m.merge(&zotero.Item{Key: "A2", Data: zotero.ItemData{ParentKey: "item1", Filename: "b.pdf"}})
+	m.merge(&zotero.Item{Key: "A3", Data: zotero.ItemData{
+		ParentKey: "missing", LinkMode: "linked_url", URL: "https://example.com"}})
+	m.merge(&zotero.Item{Key: "A4", Data: zotero.ItemData{ParentKey: "missing"}})
+	m.merge(&zotero.Item{Key: "item1", Data: zotero.ItemData{Title: "Item", ItemType: "book"}})
+	m.finish(1)
+	assert.Equal(t, 4, m.orphans)
+	keys := []string{}
+	for _, item := range lib.Items {
+		assert.NotEmpty(t, item.Title)
+		keys = append(keys, item.Key)
+	}
+	assert.ElementsMatch(t, []string{"N1", "A1", "A3", "A4", "item1"}, keys)
+	for _, item := range lib.Items {
+		switch item.Key {
+		case "N1":
+			assert.Equal(t, "Old orphan", item.Title)
+			assert.Len(t, item.Notes, 1)
+		case "A1":
+			assert.Equal(t, "attachment", item.ItemType)
+			assert.Equal(t, "a.pdf", item.Title)
+			assert.Len(t, item.Attachments, 1)
+		case "A3":
+			assert.Equal(t, "https://example.com", item.Title)
+		case "A4":
+			assert.Equal(t, "A4", item.Title)
+		case "item1":
+			assert.Len(t, item.Attachments, 1)
+		}
+	}
+}
+
+func TestRemoveItems(t *testing.T) {
+	var lib storage.Library
+	lib.Items = []storage.Item{
+		{
+			Key:         "item1",
+			Attachments: []storage.Attachment{{Key: "item2"}},
+		},
+		{
+			Key:         "item3",
+			Attachments: []storage.Attachment{{Key: "item4"}, {Key: "item5"}},
+		},
+		{
+			Key:         "item6",
+			Attachments: []storage.Attachment{},
+		},
+	}
+	removed := removeItems(&lib, []string{"item1", "item5", "unknown"})
+	assert.Equal(t, 2, removed)
+	require.Len(t, lib.Items, 2)
+	assert.Equal(t, "item3", lib.Items[0].Key)
+	assert.Equal(t, []storage.Attachment{{Key: "item4"}}, lib.Items[0].Attachments)
+	assert.Equal(t, "item6", lib.Items[1].Key)
+}
+
+func TestMergeCollections(t *testing.T) {
+	lib := storage.Library{
+		Items: []storage.Item{
+			{Key: "item1", Collections: []string{"C1", "C2"}},
+		},
+		Collections: []storage.Collection{
+			{Key: "C1", Version: 1, Name: "Thesis"},
+			{Key: "C2", Version: 1, Name: "Old"},
+		},
+	}
+	collsRes := zotero.CollectionsResult{
+		Version: 1400,
+		Collections: []zotero.Collection{
+			{Key: "C1", Version: 1400, Data: zotero.CollectionData{Name: "PhD thesis"}},
+			{Key: "C2", Version: 1400, Data: zotero.CollectionData{Deleted: true}},
+			{Key: "C3", Version: 1400, Data: zotero.CollectionData{Name: "Related work", ParentKey: "C1"}},
+		},
+	}
+	mergeCollections(&lib, collsRes)
+	assert.Equal(t, []storage.Collection{
+		{Key: "C1", Version: 1400, Name: "PhD thesis"},
+		{Key: "C3", Version: 1400, Name: "Related work", ParentKey: "C1"},
+	}, lib.Collections)
+	assert.Equal(t, []string{"C1"}, lib.Items[0].Collections)
+}
+
+func TestRemoveCollections(t *testing.T) {
+	lib := storage.Library{
+		Items: []storage.Item{
+			{Key: "item1", Collections: []string{"C1", "C2"}},
+			{Key: "item2"},
+		},
+		Collections: []storage.Collection{{Key: "C1"}, {Key: "C2"}},
+	}
+	removed := removeCollections(&lib, []string{"C2", "unknown"})
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, []storage.Collection{{Key: "C1"}}, lib.Collections)
+	assert.Equal(t, []string{"C1"}, lib.Items[0].Collections)
+	assert.Empty(t, lib.Items[1].Collections)
+}
+
+func TestRemoveTags(t *testing.T) {
+	lib := storage.Library{
+		Items: []storage.Item{
+			{Key: "item1", Tags: []string{"to-read", "project-x"}},
+			{Key: "item2", Tags: []string{"to-read"}},
+			{Key: "item3"},
+		},
+	}
+	removeTags(&lib, []string{"to-read"})
+	assert.Equal(t, []string{"project-x"}, lib.Items[0].Tags)
+	assert.Empty(t, lib.Items[1].Tags)
+	assert.Empty(t, lib.Items[2].Tags)
+}
+
+func TestMergeItemsNotes(t *testing.T) {
+	itemsRes := itemsResult{
+		Version: 1337,
+		Items: []zotero.Item{
+			{
+				Key: "note1",
+				Data: zotero.ItemData{
+					ItemType:  noteType,
+					ParentKey: "item1",
+					Note:      "<p>Reading <b>notes</b></p>",
+				},
+			},
+			{
+				Key:  "item1",
+				Data: zotero.ItemData{Title: "title item1"},
+			},
+			{
+				Key: "note2",
+				Data: zotero.ItemData{
+					ItemType: noteType,
+					Note:     "<h1>Standalone</h1><p>body</p>",
+				},
+			},
+		},
+	}
+	var lib storage.Library
+	mergeAll(&lib, itemsRes)
+	require.Len(t, lib.Items, 2)
+	assert.Empty(t, lib.Items[0].Attachments)
+	assert.Equal(t, []storage.Note{{Key: "note1", Text: "Reading notes"}}, lib.Items[0].Notes)
+	assert.Equal(t, "Standalone", lib.Items[1].Title)
+	assert.Equal(t, []storage.Note{{Key: "note2", Text: "Standalone\nbody"}}, lib.Items[1].Notes)
+
+	removeItems(&lib, []string{"note1"})
+	assert.Empty(t, lib.Items[0].Notes)
+}
+
+func TestNoteText(t *testing.T) {
+	tests := map[string]string{
+		"<p>One</p><p>Two &amp; three</p>":                 "One\nTwo & three",
+		"<div><p>A <i>b</i>  c<br/>d</p>\n\n<p></p></div>": "A b c\nd",
+		"plain": "plain",
+	}
+	for note, exp := range tests {
+		assert.Equal(t, exp, noteText(note))
+	}
 }
@@ -0,0 +1,79 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package tags
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/fatih/color"
+)
+
+const tagsUsageTop = " " + utils.OptionsUsage
+
+var countColor = color.New(color.FgBlue)
+
+type Command struct {
+	fs          *flag.FlagSet
+	flagByCount *bool
+}
+
+func New(cmd, banner string) *Command {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	flagByCount := fs.Bool("n", false, "sort by number of items instead of by name")
+	fs.Usage = utils.MakeUsage(fs, cmd, banner, tagsUsageTop, "")
+	return &Command{fs, flagByCount}
+}
+
+func (c *Command) Run(args []string, conf config.Config) {
+	//nolint:errcheck
+	c.fs.Parse(args)
+
+	store, err := storage.FromConfig(conf)
+	if err != nil {
+		utils.Die("Failed to open the local storage:\n - %v\n", err)
+	}
+	if err := store.Load(); err != nil {
+		utils.Die("Failed to load the local storage:\n - %v\n", err)
+	}
+
+	for _, tc := range countTags(&store.Data, *c.flagByCount) {
+		fmt.Printf("%s %s\n", tc.tag, countColor.Sprintf("(%d)", tc.count))
+	}
+}
+
+type tagCount struct {
+	tag   string
+	count int
+}
+
+// countTags counts the items having each tag across all the libraries
+func countTags(data *storage.StoredData, byCount bool) []tagCount {
+	counts := make(map[string]int)
+	for i := range data.Libs {
+		for j := range data.Libs[i].Items {
+			for _, tag := range data.Libs[i].Items[j].Tags {
+				counts[tag]++
+			}
+		}
+	}
+
+	tcs := make([]tagCount, 0, len(counts))
+	for tag, count := range counts {
+		tcs = append(tcs, tagCount{tag, count})
+	}
+	sort.Slice(tcs, func(i, j int) bool {
+		if byCount && tcs[i].count != tcs[j].count {
+			return tcs[i].count > tcs[j].count
+		}
+		return strings.ToLower(tcs[i].tag) < strings.ToLower(tcs[j].tag)
+	})
+	return tcs
+}
@@ -0,0 +1,30 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package tags
+
+import (
+	"testing"
+
+	"github.com/acidghost/zotools/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountTags(t *testing.T) {
+	data := storage.StoredData{
+		Libs: []storage.Library{
+			{Items: []storage.Item{
+				{Key: "item1", Tags: []string{"to-read", "project-x"}},
+				{Key: "item2", Tags: []string{"Alpha"}},
+			}},
+			{Items: []storage.Item{
+				{Key: "item3", Tags: []string{"project-x"}},
+			}},
+		},
+	}
+	assert.Equal(t, []tagCount{{"Alpha", 1}, {"project-x", 2}, {"to-read", 1}},
+		countTags(&data, false))
+	assert.Equal(t, []tagCount{{"project-x", 2}, {"Alpha", 1}, {"to-read", 1}},
+		countTags(&data, true))
+}
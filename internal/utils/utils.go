@@ -10,6 +10,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fatih/color"
 )
@@ -54,3 +55,15 @@ func MakeUsage(flags *flag.FlagSet, cmd, banner, top, bottom string) func() {
 func MakePath(base, key, filename string) string {
 	return filepath.Join(base, "storage", key, filename)
 }
+
+// StringsFlag collects the values of a flag that can be repeated
+type StringsFlag []string
+
+func (s *StringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -39,3 +39,13 @@ func TestMakeUsage(t *testing.T) {
 	assert.Contains(t, bs, top)
 	assert.Contains(t, bs, bottom)
 }
+
+func TestStringsFlag(t *testing.T) {
+	var values StringsFlag
+	fs := flag.NewFlagSet("cmd", flag.ContinueOnError)
+	fs.Var(&values, "v", "")
+	err := fs.Parse([]string{"-v", "a", "-v=b"})
+	assert.NoError(t, err)
+	assert.Equal(t, StringsFlag{"a", "b"}, values)
+	assert.Equal(t, "a,b", values.String())
+}
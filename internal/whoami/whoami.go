@@ -0,0 +1,71 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package whoami
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/acidghost/zotools/internal/config"
+	"github.com/acidghost/zotools/internal/utils"
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/fatih/color"
+)
+
+const whoamiUsageTop = " " + utils.OptionsUsage
+
+var (
+	userColor   = color.New(color.FgHiGreen)
+	rightsColor = color.New(color.FgBlue)
+)
+
+type Command struct {
+	fs *flag.FlagSet
+}
+
+func New(cmd, banner string) *Command {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.Usage = utils.MakeUsage(fs, cmd, banner, whoamiUsageTop, "")
+	return &Command{fs}
+}
+
+func (c *Command) Run(args []string, conf config.Config) {
+	//nolint:errcheck
+	c.fs.Parse(args)
+
+	zot, err := zotero.New(conf.Key, conf.ZoteroOptions())
+	if err != nil {
+		var statusErr *zotero.ErrWrongStatus
+		if errors.As(err, &statusErr) && statusErr.Status() == http.StatusForbidden {
+			utils.Die("Zotero rejected the API key (%s), check the key in the configuration\n",
+				statusErr.Body())
+		}
+		utils.Die("Failed to initialize Zotero API:\n - %v\n", err)
+	}
+
+	libs, err := zot.Libraries()
+	if err != nil {
+		utils.Die("Failed to list libraries:\n - %v\n", err)
+	}
+
+	printKey(os.Stdout, zot.Key(), libs)
+}
+
+// printKey shows the owner of the key and its rights on each library
+func printKey(w io.Writer, key zotero.KeyInfo, libs []zotero.Library) {
+	fmt.Fprintf(w, "%s (user ID %d)\n", userColor.Sprint(key.Username), key.UserID)
+	if len(libs) == 0 {
+		fmt.Fprintln(w, "The key cannot read any library")
+		return
+	}
+	for _, lib := range libs {
+		fmt.Fprintf(w, "  %s library %q (%d): %s\n", lib.Type, lib.Name, lib.ID,
+			rightsColor.Sprint(key.Access.Library(lib)))
+	}
+}
@@ -0,0 +1,36 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package whoami
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/acidghost/zotools/internal/zotero"
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintKey(t *testing.T) {
+	color.NoColor = true
+	key := zotero.KeyInfo{UserID: 1337, Username: "me", Access: zotero.Access{
+		User:   zotero.Rights{Library: true, Notes: true},
+		Groups: map[string]zotero.Rights{"all": {Library: true, Write: true}},
+	}}
+	libs := []zotero.Library{
+		{Type: zotero.UserLibrary, ID: 1337, Name: "me"},
+		{Type: zotero.GroupLibrary, ID: 42, Name: "Team"},
+	}
+	var out bytes.Buffer
+	printKey(&out, key, libs)
+	assert.Equal(t, `me (user ID 1337)
+  user library "me" (1337): read items, read notes
+  group library "Team" (42): read items, read notes, download files, write
+`, out.String())
+
+	out.Reset()
+	printKey(&out, key, nil)
+	assert.Equal(t, "me (user ID 1337)\nThe key cannot read any library\n", out.String())
+}
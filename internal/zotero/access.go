@@ -0,0 +1,112 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package zotero
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyInfo describes the owner of the API key and what the key can access
+type KeyInfo struct {
+	UserID   uint   `json:"userId"`
+	Username string `json:"username"`
+	Access   Access `json:"access"`
+}
+
+// Access lists the rights of a key on the personal library and on the groups
+type Access struct {
+	User Rights `json:"user"`
+	// Rights by group ID, "all" applying to the groups not listed
+	Groups map[string]Rights `json:"groups"`
+}
+
+// Rights of a key on a library, the API uses only Library and Write for groups
+type Rights struct {
+	Library bool `json:"library"`
+	Files   bool `json:"files"`
+	Notes   bool `json:"notes"`
+	Write   bool `json:"write"`
+}
+
+// Permission is an operation that requires a right
+type Permission uint
+
+const (
+	ReadLibrary Permission = iota
+	ReadFiles
+	ReadNotes
+	WriteLibrary
+)
+
+func (p Permission) String() string {
+	switch p {
+	case ReadLibrary:
+		return "read items"
+	case ReadFiles:
+		return "download files"
+	case ReadNotes:
+		return "read notes"
+	case WriteLibrary:
+		return "write"
+	}
+	return fmt.Sprintf("Permission(%d)", uint(p))
+}
+
+// Library returns the rights on lib
+func (a *Access) Library(lib Library) Rights {
+	if lib.Type == UserLibrary {
+		return a.User
+	}
+	rights, ok := a.Groups[fmt.Sprint(lib.ID)]
+	if !ok {
+		rights = a.Groups["all"]
+	}
+	// Group libraries have no separate rights for notes and files
+	rights.Notes = rights.Library
+	rights.Files = rights.Library
+	return rights
+}
+
+// Allows tells whether the rights include the permission
+func (r Rights) Allows(p Permission) bool {
+	switch p {
+	case ReadLibrary:
+		return r.Library
+	case ReadFiles:
+		return r.Library && r.Files
+	case ReadNotes:
+		return r.Library && r.Notes
+	case WriteLibrary:
+		return r.Write
+	}
+	return false
+}
+
+func (r Rights) String() string {
+	names := []string{}
+	for _, p := range []Permission{ReadLibrary, ReadNotes, ReadFiles, WriteLibrary} {
+		if r.Allows(p) {
+			names = append(names, p.String())
+		}
+	}
+	if len(names) == 0 {
+		return "no access"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Key describes the API key in use
+func (z *Zotero) Key() KeyInfo {
+	return z.userInfo
+}
+
+// Check fails with ErrPermission when the key lacks the permission on lib
+func (z *Zotero) Check(lib Library, p Permission) error {
+	if !z.userInfo.Access.Library(lib).Allows(p) {
+		return NewErrPermission(p.String(), lib.Name)
+	}
+	return nil
+}
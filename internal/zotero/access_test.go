@@ -0,0 +1,81 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package zotero
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const keyAccessReply = `{
+    "key": "someapikey",
+    "userID": 1337,
+    "username": "myusername",
+    "access": {
+        "user": {"library": true, "files": true},
+        "groups": {"all": {"library": true}, "42": {"library": true, "write": true}, "7": {}}
+    }
+}`
+
+func TestAccess(t *testing.T) {
+	var info KeyInfo
+	require.NoError(t, json.Unmarshal([]byte(keyAccessReply), &info))
+	assert.Equal(t, uint(1337), info.UserID)
+
+	user := info.Access.Library(userLib)
+	assert.Equal(t, Rights{Library: true, Files: true}, user)
+	assert.True(t, user.Allows(ReadFiles))
+	assert.False(t, user.Allows(ReadNotes))
+	assert.Equal(t, "read items, download files", user.String())
+
+	team := info.Access.Library(Library{GroupLibrary, 42, "Team"})
+	assert.Equal(t, "read items, read notes, download files, write", team.String())
+	other := info.Access.Library(Library{GroupLibrary, 99, "Other"})
+	assert.Equal(t, "read items, read notes, download files", other.String())
+	closed := info.Access.Library(Library{GroupLibrary, 7, "Closed"})
+	assert.Equal(t, "no access", closed.String())
+}
+
+func TestCheck(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+	z := zotFromServer(ts)
+	z.userInfo = KeyInfo{}
+	require.NoError(t, json.Unmarshal([]byte(keyAccessReply), &z.userInfo))
+
+	_, err := z.File(Library{GroupLibrary, 7, "Closed"}, "A1")
+	var e *ErrPermission
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, `key cannot download files in library "Closed"`, err.Error())
+	_, err = z.EachItem(Library{GroupLibrary, 7, "Closed"}, 0, func(*Item) error { return nil })
+	assert.ErrorAs(t, err, &e)
+	assert.EqualError(t, z.Check(userLib, ReadNotes), `key cannot read notes in library "myusername"`)
+	assert.NoError(t, z.Check(userLib, ReadFiles))
+	assert.Equal(t, 0, requests)
+}
+
+func TestLibrariesAccess(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `[{"id":42,"data":{"name":"Team"}},{"id":7,"data":{"name":"Closed"}}]`)
+	}))
+	defer ts.Close()
+	z := zotFromServer(ts)
+	z.userInfo = KeyInfo{}
+	require.NoError(t, json.Unmarshal([]byte(keyAccessReply), &z.userInfo))
+	libs, err := z.Libraries()
+	require.NoError(t, err)
+	assert.Equal(t, []Library{userLib, {GroupLibrary, 42, "Team"}}, libs)
+}
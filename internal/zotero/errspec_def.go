@@ -107,14 +107,16 @@ func (*ErrJSON) Is(e errSpec) bool { return e == errJSON }
 type ErrWrongStatus struct {
 	recv int
 	exp  int
+	url  string
+	body string
 }
 
-func NewErrWrongStatus(recv int, exp int) *ErrWrongStatus {
-	return &ErrWrongStatus{recv, exp}
+func NewErrWrongStatus(recv int, exp int, url string, body string) *ErrWrongStatus {
+	return &ErrWrongStatus{recv, exp, url, body}
 }
 
 func (e *ErrWrongStatus) Error() string {
-	return fmt.Sprintf("received %v status code instead of %v", e.recv, e.exp)
+	return fmt.Sprintf("received %v status code instead of %v from %s: %s", e.recv, e.exp, e.url, e.body)
 }
 
 func (*ErrWrongStatus) Is(e errSpec) bool { return e == errWrongStatus }
@@ -138,3 +140,115 @@ func (e *ErrParseHeader) Wrap(cause error) error {
 }
 
 func (*ErrParseHeader) Is(e errSpec) bool { return e == errParseHeader }
+
+type ErrInvalidFlag struct {
+	value string
+}
+
+func NewErrInvalidFlag(value string) *ErrInvalidFlag {
+	return &ErrInvalidFlag{value}
+}
+
+func (e *ErrInvalidFlag) Error() string {
+	return fmt.Sprintf("invalid flag value %s", e.value)
+}
+
+func (*ErrInvalidFlag) Is(e errSpec) bool { return e == errInvalidFlag }
+
+type ErrLibraryChanged struct {
+	exp  uint
+	recv uint
+}
+
+func NewErrLibraryChanged(exp uint, recv uint) *ErrLibraryChanged {
+	return &ErrLibraryChanged{exp, recv}
+}
+
+func (e *ErrLibraryChanged) Error() string {
+	return fmt.Sprintf("library changed from version %d to %d", e.exp, e.recv)
+}
+
+func (*ErrLibraryChanged) Is(e errSpec) bool { return e == errLibraryChanged }
+
+type ErrProxyURL struct {
+	_errWrap
+	proxy string
+}
+
+func NewErrProxyURL(proxy string, err error) *ErrProxyURL {
+	return &ErrProxyURL{_errWrap{err}, proxy}
+}
+
+func (e *ErrProxyURL) Error() string {
+	return fmt.Sprintf("parsing proxy URL %q: %v", e.proxy, e.cause)
+}
+
+func (e *ErrProxyURL) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*ErrProxyURL) Is(e errSpec) bool { return e == errProxyURL }
+
+type ErrReadCA struct {
+	_errWrap
+	path string
+}
+
+func NewErrReadCA(path string, err error) *ErrReadCA {
+	return &ErrReadCA{_errWrap{err}, path}
+}
+
+func (e *ErrReadCA) Error() string {
+	return fmt.Sprintf("reading CA bundle %q: %v", e.path, e.cause)
+}
+
+func (e *ErrReadCA) Wrap(cause error) error {
+	e.cause = cause
+	return e
+}
+
+func (*ErrReadCA) Is(e errSpec) bool { return e == errReadCA }
+
+type ErrNoCerts struct {
+	path string
+}
+
+func NewErrNoCerts(path string) *ErrNoCerts {
+	return &ErrNoCerts{path}
+}
+
+func (e *ErrNoCerts) Error() string {
+	return fmt.Sprintf("no certificates found in %q", e.path)
+}
+
+func (*ErrNoCerts) Is(e errSpec) bool { return e == errNoCerts }
+
+type ErrPermission struct {
+	what string
+	lib  string
+}
+
+func NewErrPermission(what string, lib string) *ErrPermission {
+	return &ErrPermission{what, lib}
+}
+
+func (e *ErrPermission) Error() string {
+	return fmt.Sprintf("key cannot %s in library %q", e.what, e.lib)
+}
+
+func (*ErrPermission) Is(e errSpec) bool { return e == errPermission }
+
+type ErrNotModified struct {
+	version uint
+}
+
+func NewErrNotModified(version uint) *ErrNotModified {
+	return &ErrNotModified{version}
+}
+
+func (e *ErrNotModified) Error() string {
+	return fmt.Sprintf("library not modified since version %d", e.version)
+}
+
+func (*ErrNotModified) Is(e errSpec) bool { return e == errNotModified }
@@ -0,0 +1,94 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package zotero
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	backoffHeader    = "Backoff"
+	retryAfterHeader = "Retry-After"
+)
+
+const (
+	defaultMaxAttempts = 5
+	baseRetryDelay     = time.Second
+	maxRetryDelay      = time.Minute
+	defaultTimeout     = time.Minute
+)
+
+// sleep waits for d unless ctx is done first; replaced in tests to avoid waiting
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryDelay is the exponential backoff with jitter to wait after the given
+// (1-based) attempt failed
+func retryDelay(attempt uint) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 7 {
+		delay = baseRetryDelay << (attempt - 1)
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// Wait between half and the whole delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// shouldRetry tells whether a reply with the given status code is transient
+func shouldRetry(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// parseSeconds reads a header holding a number of seconds or, as allowed for
+// Retry-After, an HTTP date. It returns 0 when the header is missing or
+// invalid.
+func parseSeconds(header http.Header, name string) time.Duration {
+	value := header.Get(name)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// waitBackoff waits until the end of the last backoff requested by the
+// server, if any
+func (z *Zotero) waitBackoff(ctx context.Context) error {
+	z.backoffMu.Lock()
+	wait := time.Until(z.backoffUntil)
+	z.backoffMu.Unlock()
+	if wait > 0 {
+		return sleep(ctx, wait)
+	}
+	return nil
+}
+
+// setBackoff records the backoff requested by the server with a reply
+func (z *Zotero) setBackoff(header http.Header) {
+	if backoff := parseSeconds(header, backoffHeader); backoff > 0 {
+		z.backoffMu.Lock()
+		z.backoffUntil = time.Now().Add(backoff)
+		z.backoffMu.Unlock()
+	}
+}
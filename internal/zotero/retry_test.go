@@ -0,0 +1,156 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package zotero
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSleep records the waits instead of sleeping
+func stubSleep(t *testing.T) *[]time.Duration {
+	waits := []time.Duration{}
+	oldSleep := sleep
+	t.Cleanup(func() { sleep = oldSleep })
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	return &waits
+}
+
+// failingServer replies with the given statuses and headers before succeeding
+func failingServer(statuses []int, headers http.Header) (*httptest.Server, *int) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(statuses) {
+			for name, values := range headers {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(statuses[requests-1])
+			return
+		}
+		w.Header().Add(lastModifiedHeader, "42")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{}`)
+	}))
+	return ts, &requests
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("Retry-After", func(t *testing.T) {
+		waits := stubSleep(t)
+		ts, requests := failingServer([]int{http.StatusTooManyRequests},
+			http.Header{retryAfterHeader: []string{"7"}})
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.maxAttempts = 3
+		_, err := z.Deleted(userLib, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, *requests)
+		assert.Equal(t, []time.Duration{7 * time.Second}, *waits)
+	})
+	t.Run("Exponential backoff", func(t *testing.T) {
+		waits := stubSleep(t)
+		ts, requests := failingServer([]int{http.StatusServiceUnavailable, http.StatusBadGateway}, nil)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.maxAttempts = 3
+		_, err := z.Deleted(userLib, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 3, *requests)
+		require.Len(t, *waits, 2)
+		assert.GreaterOrEqual(t, int64((*waits)[0]), int64(baseRetryDelay/2))
+		assert.LessOrEqual(t, int64((*waits)[0]), int64(baseRetryDelay))
+		assert.GreaterOrEqual(t, int64((*waits)[1]), int64(baseRetryDelay))
+		assert.LessOrEqual(t, int64((*waits)[1]), int64(2*baseRetryDelay))
+	})
+	t.Run("Give up", func(t *testing.T) {
+		stubSleep(t)
+		ts, requests := failingServer([]int{500, 500, 500}, nil)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.maxAttempts = 2
+		_, err := z.Deleted(userLib, 0)
+		var e *ErrWrongStatus
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, http.StatusInternalServerError, e.recv)
+		assert.Equal(t, 2, *requests)
+	})
+	t.Run("No retry on client errors", func(t *testing.T) {
+		stubSleep(t)
+		ts, requests := failingServer([]int{http.StatusForbidden}, nil)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.maxAttempts = 3
+		_, err := z.Deleted(userLib, 0)
+		var e *ErrWrongStatus
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, 1, *requests)
+	})
+	t.Run("Network errors", func(t *testing.T) {
+		waits := stubSleep(t)
+		ts := httptest.NewUnstartedServer(nil)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.maxAttempts = 3
+		_, err := z.Deleted(userLib, 0)
+		var e *ErrMakeReq
+		require.ErrorAs(t, err, &e)
+		assert.Len(t, *waits, 2)
+	})
+	t.Run("Cancelled", func(t *testing.T) {
+		waits := stubSleep(t)
+		ts, requests := failingServer([]int{http.StatusServiceUnavailable}, nil)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.maxAttempts = 3
+		ctx, cancel := context.WithCancel(context.Background())
+		sleep = func(ctx context.Context, d time.Duration) error {
+			*waits = append(*waits, d)
+			cancel()
+			return ctx.Err()
+		}
+		_, err := z.DeletedContext(ctx, userLib, 0)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, *requests)
+		assert.Len(t, *waits, 1)
+	})
+	t.Run("Backoff", func(t *testing.T) {
+		waits := stubSleep(t)
+		ts, _ := failingServer(nil, nil)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.setBackoff(http.Header{backoffHeader: []string{"30"}})
+		_, err := z.Deleted(userLib, 0)
+		require.NoError(t, err)
+		require.Len(t, *waits, 1)
+		assert.Greater(t, int64((*waits)[0]), int64(29*time.Second))
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := uint(1); attempt < 100; attempt++ {
+		assert.LessOrEqual(t, int64(retryDelay(attempt)), int64(maxRetryDelay))
+		assert.Greater(t, int64(retryDelay(attempt)), int64(0))
+	}
+}
+
+func TestParseSeconds(t *testing.T) {
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	header := http.Header{"A": []string{"120"}, "B": []string{date}, "C": []string{"soon"}}
+	assert.Equal(t, 2*time.Minute, parseSeconds(header, "A"))
+	assert.InDelta(t, float64(time.Hour), float64(parseSeconds(header, "B")), float64(2*time.Second))
+	assert.Equal(t, time.Duration(0), parseSeconds(header, "C"))
+	assert.Equal(t, time.Duration(0), parseSeconds(header, "D"))
+}
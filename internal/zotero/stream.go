@@ -0,0 +1,199 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package zotero
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// EachItem calls fn with each item modified after the library version since,
+// or with every item when since is 0, decoding them while they are received.
+// Once the first page tells how many items there are, the other pages are
+// fetched concurrently and handed to fn in order, a few pages at a time. If
+// the library changes in the meantime the iteration starts over, so fn may
+// see an item more than once. It returns the library version, or fails with
+// ErrNotModified when the library did not change at all after since.
+func (z *Zotero) EachItem(lib Library, since uint, fn func(*Item) error) (uint, error) {
+	return z.EachItemContext(context.Background(), lib, since, fn)
+}
+
+func (z *Zotero) EachItemContext(ctx context.Context, lib Library, since uint,
+	fn func(*Item) error) (uint, error) {
+	return z.restartOnChange(ctx, func() (uint, error) {
+		return z.eachItem(ctx, lib, since, fn)
+	})
+}
+
+// restartOnChange repeats fetch while it fails with ErrLibraryChanged, up to
+// the maximum number of attempts
+func (z *Zotero) restartOnChange(ctx context.Context, fetch func() (uint, error)) (uint, error) {
+	for attempt := uint(1); ; attempt++ {
+		version, err := fetch()
+		var changed *ErrLibraryChanged
+		if errors.As(err, &changed) && attempt < z.maxAttempts && ctx.Err() == nil {
+			fmt.Printf("Library changed while fetching items, restarting\n")
+			continue
+		}
+		return version, err
+	}
+}
+
+type itemsPageResult struct {
+	items   []Item
+	version uint
+	err     error
+}
+
+func (z *Zotero) eachItem(ctx context.Context, lib Library, since uint, fn func(*Item) error) (uint, error) {
+	version, total, err := z.streamItems(ctx, lib, since, 0, since, fn)
+	if err != nil {
+		return 0, err
+	}
+
+	pages := int((total + MaxLimit - 1) / MaxLimit)
+	if pages <= 1 {
+		return version, nil
+	}
+
+	jobs := int(z.jobs)
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	// Stopping early cancels the requests still running
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	results := make([]chan itemsPageResult, pages)
+	for page := range results {
+		results[page] = make(chan itemsPageResult, 1)
+	}
+	// Bounds the pages fetched but not yet handed to fn
+	window := make(chan struct{}, 2*jobs)
+	pagesCh := make(chan int)
+	go func() {
+		defer close(pagesCh)
+		for page := 1; page < pages; page++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case pagesCh <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer wg.Done()
+			for page := range pagesCh {
+				res := itemsPageResult{items: make([]Item, 0, MaxLimit)}
+				res.version, _, res.err = z.streamItems(ctx, lib, since, uint(page*MaxLimit), 0,
+					func(item *Item) error {
+						res.items = append(res.items, *item)
+						return nil
+					})
+				results[page] <- res
+			}
+		}()
+	}
+
+	for page := 1; page < pages; page++ {
+		var res itemsPageResult
+		select {
+		case res = <-results[page]:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		<-window
+		if res.err != nil {
+			return 0, res.err
+		}
+		if res.version != version {
+			return 0, NewErrLibraryChanged(version, res.version)
+		}
+		for i := range res.items {
+			if err := fn(&res.items[i]); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return version, nil
+}
+
+// streamItems requests a page of items, calling fn with each one while
+// decoding the reply. It returns the library version and the total number of
+// items. Unless ifModified is 0, the request is conditional as in openSince.
+func (z *Zotero) streamItems(ctx context.Context, lib Library, since, start, ifModified uint,
+	fn func(*Item) error) (uint, uint64, error) {
+	if err := z.Check(lib, ReadLibrary); err != nil {
+		return 0, 0, err
+	}
+	url := fmt.Sprintf("%s%s/items?since=%d&includeTrashed=1&limit=%d&start=%d",
+		z.url, lib.Prefix(), since, MaxLimit, start)
+
+	fmt.Printf("Requesting %s\n", url)
+	resp, err := z.openSince(ctx, url, ifModified)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer resp.Body.Close()
+
+	total, err := strconv.ParseUint(resp.Header.Get(totalResHeader), 10, 64)
+	if err != nil {
+		return 0, 0, NewErrParseHeader(totalResHeader, err)
+	}
+
+	version, err := parseVersion(resp.Header)
+	if err != nil {
+		return 0, total, err
+	}
+
+	if err := decodeItems(resp.Body, fn); err != nil {
+		return 0, total, err
+	}
+
+	return version, total, nil
+}
+
+// decodeItems calls fn with each item of the JSON array read from r
+func decodeItems(r io.Reader, fn func(*Item) error) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return NewErrJSON(err)
+	} else if tok != json.Delim('[') {
+		return NewErrJSON(fmt.Errorf("expected an array, found %v", tok))
+	}
+	for dec.More() {
+		var item Item
+		if err := dec.Decode(&item); err != nil {
+			return NewErrJSON(err)
+		}
+		if err := fn(&item); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return NewErrJSON(err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// (c) Copyright 2021, zotools' Authors.
+//
+// Licensed under the terms of the GNU AGPL License version 3.
+
+package zotero
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedServer replies to the items requests with one item per page, keyed by
+// the start of the page
+func pagedServer(pages int, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Add(totalResHeader, fmt.Sprint(MaxLimit*pages))
+		w.Header().Add(lastModifiedHeader, "42")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `[{"key":"%s","version":1,"data":{}}]`, r.URL.Query().Get("start"))
+	}))
+}
+
+func TestEachItem(t *testing.T) {
+	t.Run("In order", func(t *testing.T) {
+		var requests int32
+		ts := pagedServer(8, &requests)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.jobs = 3
+		keys := []string{}
+		version, err := z.EachItem(userLib, 0, func(item *Item) error {
+			keys = append(keys, item.Key)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, uint(42), version)
+		assert.Equal(t, []string{"0", "100", "200", "300", "400", "500", "600", "700"}, keys)
+	})
+	t.Run("Stop on error", func(t *testing.T) {
+		var requests int32
+		ts := pagedServer(50, &requests)
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.jobs = 2
+		stop := errors.New("stop")
+		seen := 0
+		_, err := z.EachItem(userLib, 0, func(item *Item) error {
+			seen++
+			if item.Key == "100" {
+				return stop
+			}
+			return nil
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 2, seen)
+		// Only the pages within the window are requested
+		assert.LessOrEqual(t, atomic.LoadInt32(&requests), int32(1+2*2+2))
+	})
+}
+
+func TestDecodeItems(t *testing.T) {
+	keys := []string{}
+	collect := func(item *Item) error {
+		keys = append(keys, item.Key)
+		return nil
+	}
+	require.NoError(t, decodeItems(strings.NewReader(`[{"key":"A"},{"key":"B"}]`), collect))
+	assert.Equal(t, []string{"A", "B"}, keys)
+
+	var e *ErrJSON
+	assert.ErrorAs(t, decodeItems(strings.NewReader(`{"key":"A"}`), collect), &e)
+	assert.ErrorAs(t, decodeItems(strings.NewReader(`[{"key":"A"},`), collect), &e)
+	assert.ErrorAs(t, decodeItems(strings.NewReader(`[{"key":1}]`), collect), &e)
+}
@@ -5,11 +5,20 @@
 package zotero
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -23,13 +32,9 @@ const (
 	apiVersionHeader   = "Zotero-API-Version"
 	lastModifiedHeader = "Last-Modified-Version"
 	totalResHeader     = "Total-Results"
+	ifModifiedHeader   = "If-Modified-Since-Version"
 )
 
-type apiKey struct {
-	UserID   uint   `json:"userId"`
-	Username string `json:"username"`
-}
-
 type Item struct {
 	Key     string   `json:"key"`
 	Version uint     `json:"version"`
@@ -44,6 +49,66 @@ type ItemData struct {
 	ParentKey   string    `json:"parentItem,omitempty"`
 	ContentType string    `json:"contentType,omitempty"`
 	Filename    string    `json:"filename,omitempty"`
+	MD5         string    `json:"md5,omitempty"`
+	MTime       int64     `json:"mtime,omitempty"`
+	LinkMode    string    `json:"linkMode,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	Collections []string  `json:"collections,omitempty"`
+	Tags        []Tag     `json:"tags,omitempty"`
+	Deleted     Flag      `json:"deleted,omitempty"`
+	// All the other non-empty string fields, e.g. date, DOI, etc.
+	Fields map[string]string `json:"-"`
+}
+
+// Fields of ItemData that are decoded into their own member
+var itemDataFields = map[string]bool{
+	"key": true, "title": true, "abstractNote": true, "itemType": true,
+	"parentItem": true, "contentType": true, "filename": true, "md5": true,
+	"linkMode": true, "path": true, "url": true, "note": true,
+}
+
+func (d *ItemData) UnmarshalJSON(data []byte) error {
+	// Decode the known fields with a type not implementing json.Unmarshaler
+	type itemData ItemData
+	if err := json.Unmarshal(data, (*itemData)(d)); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	d.Fields = make(map[string]string)
+	for name, value := range raw {
+		var s string
+		if itemDataFields[name] || json.Unmarshal(value, &s) != nil || s == "" {
+			continue
+		}
+		d.Fields[name] = s
+	}
+	return nil
+}
+
+type Tag struct {
+	Tag  string `json:"tag"`
+	Type uint   `json:"type,omitempty"`
+}
+
+// Flag is a boolean that the API may encode either as a number or as a bool
+type Flag bool
+
+func (f *Flag) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "1", "true":
+		*f = true
+	case "0", "false", "null":
+		*f = false
+	default:
+		return NewErrInvalidFlag(string(data))
+	}
+	return nil
 }
 
 type Creator struct {
@@ -51,11 +116,70 @@ type Creator struct {
 	LastName  string `json:"lastName"`
 }
 
+type LibraryType string
+
+const (
+	UserLibrary  LibraryType = "user"
+	GroupLibrary LibraryType = "group"
+)
+
+// Library identifies either the personal library of the user or a group library
+type Library struct {
+	Type LibraryType
+	ID   uint
+	Name string
+}
+
+// Prefix is the path of the library in the API URLs, e.g. /users/1337
+func (l *Library) Prefix() string {
+	if l.Type == GroupLibrary {
+		return fmt.Sprintf("/groups/%d", l.ID)
+	}
+	return fmt.Sprintf("/users/%d", l.ID)
+}
+
+type group struct {
+	ID   uint `json:"id"`
+	Data struct {
+		Name string `json:"name"`
+	} `json:"data"`
+}
+
 type Zotero struct {
-	key      string
-	url      string
-	client   http.Client
-	userInfo apiKey
+	key       string
+	url       string
+	userAgent string
+	client    http.Client
+	userInfo  KeyInfo
+	// Time limit for reading the buffered replies
+	timeout time.Duration
+	// Maximum number of attempts for each request
+	maxAttempts uint
+	// Number of concurrent requests when fetching all the items
+	jobs uint
+	// Time until when the server asked us not to send requests
+	backoffUntil time.Time
+	backoffMu    sync.Mutex
+}
+
+// Options tunes the client, the zero value selects the defaults
+type Options struct {
+	// Maximum number of attempts for each request, retrying on network
+	// errors, throttling and server errors
+	MaxAttempts uint
+	// Number of concurrent requests when fetching all the items
+	Jobs uint
+	// Time limit for each request to get a reply and, unless it is a file
+	// being downloaded, to read it
+	Timeout time.Duration
+	// Base URL of the API, e.g. of a self-hosted dataserver
+	URL string
+	// URL of the HTTP proxy, otherwise taken from the environment
+	Proxy string
+	// File with the PEM certificates to trust besides the system ones
+	CABundle string
+	// Value of the User-Agent header
+	UserAgent string
 }
 
 type errSpec string
@@ -65,122 +189,483 @@ const (
 	errMakeReq     = errSpec("wrap:executing request to {{req.URL http.Request %s}}")
 	errReadBody    = errSpec("wrap:reading response body")
 	errJSON        = errSpec("wrap:parsing JSON from reply")
-	errWrongStatus = errSpec("nowrap:received {{recv int %v}} status code instead of {{exp int %v}}")
+	errWrongStatus = errSpec("nowrap:received {{recv int %v}} status code instead of {{exp int %v}} " +
+		"from {{url string %s}}: {{body string %s}}")
 	errParseHeader = errSpec("wrap:parsing header {{header string %q}}")
+	errInvalidFlag = errSpec("nowrap:invalid flag value {{value string %s}}")
+
+	errLibraryChanged = errSpec("nowrap:library changed from version {{exp uint %d}} to {{recv uint %d}}")
+
+	errProxyURL = errSpec("wrap:parsing proxy URL {{proxy string %q}}")
+	errReadCA   = errSpec("wrap:reading CA bundle {{path string %q}}")
+	errNoCerts  = errSpec("nowrap:no certificates found in {{path string %q}}")
+
+	errNotModified = errSpec("nowrap:library not modified since version {{version uint %d}}")
+
+	errPermission = errSpec("nowrap:key cannot {{what string %s}} in library {{lib string %q}}")
 )
 
 //go:generate gorror -type=errSpec -P -import=net/http
 
-func New(key string) (*Zotero, error) {
-	return newWithURL(apiURL, key)
+func New(key string, opts Options) (*Zotero, error) {
+	return NewContext(context.Background(), key, opts)
 }
 
-func newWithURL(baseURL, key string) (*Zotero, error) {
-	url := baseURL + "/keys/current"
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, NewErrWrongURL(url, err)
+// NewContext is like New, with ctx bounding the request checking the key
+func NewContext(ctx context.Context, key string, opts Options) (*Zotero, error) {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
 	}
-
-	setHeaders(req, key)
-
-	var client http.Client
-	resp, err := client.Do(req)
+	client, err := newClient(opts, timeout)
 	if err != nil {
-		return nil, NewErrMakeReq(*req, err)
+		return nil, err
 	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, NewErrWrongStatus(resp.StatusCode, http.StatusOK)
+	baseURL := strings.TrimRight(opts.URL, "/")
+	if baseURL == "" {
+		baseURL = apiURL
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	z := &Zotero{
+		key:         key,
+		url:         baseURL,
+		userAgent:   opts.UserAgent,
+		client:      client,
+		timeout:     timeout,
+		maxAttempts: maxAttempts,
+		jobs:        opts.Jobs,
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
+	_, respBody, err := z.get(ctx, baseURL+"/keys/current")
 	if err != nil {
-		return nil, NewErrReadBody(err)
+		return nil, err
 	}
 
-	var apiKeyInfo apiKey
-	if err := json.Unmarshal(respBody, &apiKeyInfo); err != nil {
+	if err := json.Unmarshal(respBody, &z.userInfo); err != nil {
 		return nil, NewErrJSON(err)
 	}
 
-	return &Zotero{key, baseURL, client, apiKeyInfo}, nil
+	return z, nil
 }
 
-func setHeaders(req *http.Request, key string) {
+// newClient sets up the timeout, the proxy and the trusted certificates. The
+// timeout only covers waiting for the reply, files are downloaded as long as
+// they keep coming.
+func newClient(opts Options, timeout time.Duration) (http.Client, error) {
+	var client http.Client
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return client, NewErrProxyURL(opts.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return client, NewErrReadCA(opts.CABundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return client, NewErrNoCerts(opts.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	client.Transport = transport
+	return client, nil
+}
+
+func setHeaders(req *http.Request, key, userAgent string) {
 	req.Header.Add(apiVersionHeader, fmt.Sprint(apiVersion))
 	req.Header.Add(authHeader, key)
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
 }
 
-type ItemsResult struct {
-	Items   []Item
-	Version uint
+// open performs an authenticated GET request and returns the reply, whose
+// body must be closed by the caller. Transient failures are retried, waiting
+// as long as the server asks to or with exponential backoff, until ctx is done.
+func (z *Zotero) open(ctx context.Context, url string) (*http.Response, error) {
+	return z.openSince(ctx, url, 0)
 }
 
-func (z *Zotero) Items(start, limit uint) (*ItemsResult, bool, error) {
-	url := fmt.Sprintf("%s/users/%d/items?limit=%d&start=%d",
-		z.url, z.userInfo.UserID, limit, start)
-
-	fmt.Printf("Requesting items %s\n", url)
-	req, err := http.NewRequest("GET", url, nil)
+// openSince is like open but, unless version is 0, fails with ErrNotModified
+// when the library did not change after that version
+func (z *Zotero) openSince(ctx context.Context, url string, version uint) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, false, NewErrWrongURL(url, err)
+		return nil, NewErrWrongURL(url, err)
+	}
+
+	setHeaders(req, z.key, z.userAgent)
+	if version > 0 {
+		req.Header.Set(ifModifiedHeader, fmt.Sprint(version))
+	}
+
+	for attempt := uint(1); ; attempt++ {
+		if err := z.waitBackoff(ctx); err != nil {
+			return nil, NewErrMakeReq(*req, err)
+		}
+		last := attempt >= z.maxAttempts
+
+		resp, err := z.client.Do(req)
+		if err != nil {
+			if last || ctx.Err() != nil {
+				return nil, NewErrMakeReq(*req, err)
+			}
+			if err := sleep(ctx, retryDelay(attempt)); err != nil {
+				return nil, NewErrMakeReq(*req, err)
+			}
+			continue
+		}
+
+		z.setBackoff(resp.Header)
+
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		if resp.StatusCode == http.StatusNotModified && version > 0 {
+			resp.Body.Close()
+			return nil, NewErrNotModified(version)
+		}
+
+		statusErr := newStatusError(resp)
+		resp.Body.Close()
+		if last || !shouldRetry(resp.StatusCode) {
+			return nil, statusErr
+		}
+
+		delay := parseSeconds(resp.Header, retryAfterHeader)
+		if delay <= 0 {
+			delay = retryDelay(attempt)
+		}
+		fmt.Printf("Received %d status code, retrying in %v\n", resp.StatusCode, delay.Round(time.Second))
+		if err := sleep(ctx, delay); err != nil {
+			return nil, NewErrMakeReq(*req, err)
+		}
+	}
+}
+
+// Longest part of an error reply kept in ErrWrongStatus
+const maxErrorBody = 512
+
+// newStatusError keeps the message that Zotero puts in the body of error
+// replies, e.g. "Invalid key", falling back to the status text
+func newStatusError(resp *http.Response) *ErrWrongStatus {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
 	}
+	return NewErrWrongStatus(resp.StatusCode, http.StatusOK, resp.Request.URL.String(), msg)
+}
+
+// Status is the status code of the reply
+func (e *ErrWrongStatus) Status() int { return e.recv }
+
+// URL is the address of the failed request
+func (e *ErrWrongStatus) URL() string { return e.url }
 
-	setHeaders(req, z.key)
+// Body is the message of the reply, or the status text if it was empty
+func (e *ErrWrongStatus) Body() string { return e.body }
 
-	resp, err := z.client.Do(req)
+// get performs an authenticated GET request and returns the reply headers and body
+func (z *Zotero) get(ctx context.Context, url string) (http.Header, []byte, error) {
+	return z.getSince(ctx, url, 0)
+}
+
+// getSince is like get with the conditional request of openSince
+func (z *Zotero) getSince(ctx context.Context, url string, version uint) (http.Header, []byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := z.openSince(ctx, url, version)
 	if err != nil {
-		return nil, false, NewErrMakeReq(*req, err)
+		return nil, nil, err
 	}
 
 	defer resp.Body.Close()
+	// The reply is read within the timeout as well
+	if z.timeout > 0 {
+		timer := time.AfterFunc(z.timeout, cancel)
+		defer timer.Stop()
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, NewErrReadBody(err)
+	}
+
+	return resp.Header, respBody, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, false, NewErrWrongStatus(resp.StatusCode, http.StatusOK)
+func parseVersion(header http.Header) (uint, error) {
+	version, err := strconv.ParseUint(header.Get(lastModifiedHeader), 10, 64)
+	if err != nil {
+		return 0, NewErrParseHeader(lastModifiedHeader, err)
 	}
+	return uint(version), nil
+}
 
-	totalItems, err := strconv.ParseUint(resp.Header.Get(totalResHeader), 10, 64)
+// Libraries returns the personal library of the user followed by the group
+// libraries, keeping only the ones that the key can read.
+func (z *Zotero) Libraries() ([]Library, error) {
+	return z.LibrariesContext(context.Background())
+}
+
+func (z *Zotero) LibrariesContext(ctx context.Context) ([]Library, error) {
+	url := fmt.Sprintf("%s/users/%d/groups?limit=%d", z.url, z.userInfo.UserID, MaxLimit)
+
+	fmt.Printf("Requesting groups %s\n", url)
+	_, respBody, err := z.get(ctx, url)
 	if err != nil {
-		return nil, false, NewErrParseHeader(totalResHeader, err)
+		return nil, err
+	}
+
+	groups := []group{}
+	if err := json.Unmarshal(respBody, &groups); err != nil {
+		return nil, NewErrJSON(err)
 	}
 
-	more := uint64(start+limit) < totalItems
-	items := []Item{}
+	all := make([]Library, 0, len(groups)+1)
+	all = append(all, Library{UserLibrary, z.userInfo.UserID, z.userInfo.Username})
+	for _, g := range groups {
+		all = append(all, Library{GroupLibrary, g.ID, g.Data.Name})
+	}
 
-	respBody, err := io.ReadAll(resp.Body)
+	libs := make([]Library, 0, len(all))
+	for _, lib := range all {
+		if z.Check(lib, ReadLibrary) == nil {
+			libs = append(libs, lib)
+		}
+	}
+
+	return libs, nil
+}
+
+// page requests limit results starting from start, decoding them into out.
+// It returns the library version and the total number of results. Unless
+// ifModified is 0, the request is conditional as in openSince.
+func (z *Zotero) page(ctx context.Context, url string, start, limit, ifModified uint, out interface{}) (
+	uint, uint64, error) {
+	url = fmt.Sprintf("%s&limit=%d&start=%d", url, limit, start)
+
+	fmt.Printf("Requesting %s\n", url)
+	header, respBody, err := z.getSince(ctx, url, ifModified)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	total, err := strconv.ParseUint(header.Get(totalResHeader), 10, 64)
 	if err != nil {
-		return nil, more, NewErrReadBody(err)
+		return 0, 0, NewErrParseHeader(totalResHeader, err)
 	}
 
-	if err := json.Unmarshal(respBody, &items); err != nil {
-		return nil, more, NewErrJSON(err)
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return 0, total, NewErrJSON(err)
 	}
 
-	versionH := resp.Header.Get(lastModifiedHeader)
-	version, err := strconv.ParseUint(versionH, 10, 64)
+	version, err := parseVersion(header)
 	if err != nil {
-		return nil, more, NewErrParseHeader(lastModifiedHeader, err)
+		return 0, total, err
+	}
+
+	return version, total, nil
+}
+
+type Collection struct {
+	Key     string         `json:"key"`
+	Version uint           `json:"version"`
+	Data    CollectionData `json:"data"`
+}
+
+type CollectionData struct {
+	Name      string    `json:"name"`
+	ParentKey ParentKey `json:"parentCollection"`
+	Deleted   Flag      `json:"deleted,omitempty"`
+}
+
+// ParentKey is the key of a parent object, which the API sets to false when
+// the object has no parent
+type ParentKey string
+
+func (p *ParentKey) UnmarshalJSON(data []byte) error {
+	if string(data) == "false" || string(data) == "null" {
+		*p = ""
+		return nil
+	}
+	var key string
+	if err := json.Unmarshal(data, &key); err != nil {
+		return err
 	}
+	*p = ParentKey(key)
+	return nil
+}
+
+type CollectionsResult struct {
+	Collections []Collection
+	Version     uint
+}
 
-	return &ItemsResult{items, uint(version)}, more, nil
+// AllCollections retrieves all the collections modified after the library
+// version since, or all of them when since is 0.
+func (z *Zotero) AllCollections(lib Library, since uint) (CollectionsResult, error) {
+	return z.AllCollectionsContext(context.Background(), lib, since)
 }
 
-func (z *Zotero) AllItems() (ItemsResult, error) {
-	ir := ItemsResult{Items: []Item{}}
+func (z *Zotero) AllCollectionsContext(ctx context.Context, lib Library, since uint) (
+	CollectionsResult, error) {
+	url := fmt.Sprintf("%s%s/collections?since=%d", z.url, lib.Prefix(), since)
+	cr := CollectionsResult{Collections: []Collection{}}
+	if err := z.Check(lib, ReadLibrary); err != nil {
+		return cr, err
+	}
 	var start uint = 0
 	for {
-		itemsRes, more, err := z.Items(start, MaxLimit)
+		colls := []Collection{}
+		version, total, err := z.page(ctx, url, start, MaxLimit, 0, &colls)
 		if err != nil {
-			return ir, err
+			return cr, err
 		}
-		ir.Version = itemsRes.Version
-		ir.Items = append(ir.Items, itemsRes.Items...)
-		if !more {
-			return ir, nil
+		cr.Version = version
+		cr.Collections = append(cr.Collections, colls...)
+		if uint64(start+MaxLimit) >= total {
+			return cr, nil
 		}
 		start += MaxLimit
 	}
 }
+
+// FulltextVersions lists the versions of the attachments whose full-text
+// content changed after the library version since
+func (z *Zotero) FulltextVersions(lib Library, since uint) (map[string]uint, uint, error) {
+	return z.FulltextVersionsContext(context.Background(), lib, since)
+}
+
+func (z *Zotero) FulltextVersionsContext(ctx context.Context, lib Library, since uint) (
+	map[string]uint, uint, error) {
+	if err := z.Check(lib, ReadLibrary); err != nil {
+		return nil, 0, err
+	}
+	url := fmt.Sprintf("%s%s/fulltext?since=%d", z.url, lib.Prefix(), since)
+
+	fmt.Printf("Requesting full-text versions %s\n", url)
+	header, respBody, err := z.get(ctx, url)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	versions := make(map[string]uint)
+	if err := json.Unmarshal(respBody, &versions); err != nil {
+		return nil, 0, NewErrJSON(err)
+	}
+
+	version, err := parseVersion(header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return versions, version, nil
+}
+
+type Fulltext struct {
+	Content      string `json:"content"`
+	IndexedPages uint   `json:"indexedPages,omitempty"`
+	TotalPages   uint   `json:"totalPages,omitempty"`
+	IndexedChars uint   `json:"indexedChars,omitempty"`
+	TotalChars   uint   `json:"totalChars,omitempty"`
+}
+
+// ItemFulltext retrieves the full-text content extracted from an attachment,
+// or nil if the attachment has not been indexed
+func (z *Zotero) ItemFulltext(lib Library, key string) (*Fulltext, error) {
+	return z.ItemFulltextContext(context.Background(), lib, key)
+}
+
+func (z *Zotero) ItemFulltextContext(ctx context.Context, lib Library, key string) (*Fulltext, error) {
+	if err := z.Check(lib, ReadLibrary); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s%s/items/%s/fulltext", z.url, lib.Prefix(), key)
+
+	_, respBody, err := z.get(ctx, url)
+	var statusErr *ErrWrongStatus
+	if errors.As(err, &statusErr) && statusErr.recv == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fulltext Fulltext
+	if err := json.Unmarshal(respBody, &fulltext); err != nil {
+		return nil, NewErrJSON(err)
+	}
+
+	return &fulltext, nil
+}
+
+// File downloads the content of an attachment; the caller has to close it
+func (z *Zotero) File(lib Library, key string) (io.ReadCloser, error) {
+	return z.FileContext(context.Background(), lib, key)
+}
+
+func (z *Zotero) FileContext(ctx context.Context, lib Library, key string) (io.ReadCloser, error) {
+	if err := z.Check(lib, ReadFiles); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s%s/items/%s/file", z.url, lib.Prefix(), key)
+
+	fmt.Printf("Downloading %s\n", url)
+	resp, err := z.open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// Deleted lists the keys (or names, for tags) of the objects that were
+// permanently deleted from the library after version since.
+type Deleted struct {
+	Collections []string `json:"collections"`
+	Items       []string `json:"items"`
+	Searches    []string `json:"searches"`
+	Tags        []string `json:"tags"`
+	Version     uint     `json:"-"`
+}
+
+func (z *Zotero) Deleted(lib Library, since uint) (*Deleted, error) {
+	return z.DeletedContext(context.Background(), lib, since)
+}
+
+func (z *Zotero) DeletedContext(ctx context.Context, lib Library, since uint) (*Deleted, error) {
+	if err := z.Check(lib, ReadLibrary); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s%s/deleted?since=%d", z.url, lib.Prefix(), since)
+
+	fmt.Printf("Requesting deleted %s\n", url)
+	header, respBody, err := z.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted Deleted
+	if err := json.Unmarshal(respBody, &deleted); err != nil {
+		return nil, NewErrJSON(err)
+	}
+
+	if deleted.Version, err = parseVersion(header); err != nil {
+		return nil, err
+	}
+
+	return &deleted, nil
+}
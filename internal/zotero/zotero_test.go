@@ -5,13 +5,20 @@
 package zotero
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -29,7 +36,7 @@ const keyReplyFmt = `{
     }
 }`
 
-func TestNewWithURL(t *testing.T) {
+func TestNew(t *testing.T) {
 	t.Run("Successful", func(t *testing.T) {
 		key, userID, username := "someapikey", uint(1337), "myusername"
 		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,14 +47,14 @@ func TestNewWithURL(t *testing.T) {
 			fmt.Fprintf(w, keyReplyFmt, keyHeader, userID, username)
 		}))
 		defer ts.Close()
-		z, err := newWithURL(ts.URL, key)
+		z, err := New(key, Options{URL: ts.URL, MaxAttempts: 1})
 		require.NoError(t, err)
 		assert.Equal(t, z.key, key)
 		assert.Equal(t, z.userInfo.UserID, userID)
 		assert.Equal(t, z.userInfo.Username, username)
 	})
 	t.Run("Broken URL", func(t *testing.T) {
-		z, err := newWithURL("...\x00..somedomain.com", "someapikey")
+		z, err := New("someapikey", Options{URL: "...\x00..somedomain.com", MaxAttempts: 1})
 		require.Error(t, err)
 		assert.Nil(t, z)
 		var e *ErrWrongURL
@@ -56,28 +63,76 @@ func TestNewWithURL(t *testing.T) {
 	t.Run("Failed request", func(t *testing.T) {
 		ts := httptest.NewUnstartedServer(nil)
 		defer ts.Close()
-		z, err := newWithURL(ts.URL, "someapikey")
+		z, err := New("someapikey", Options{URL: ts.URL, MaxAttempts: 1})
 		require.Error(t, err)
 		assert.Nil(t, z)
 		var e *ErrMakeReq
 		assert.ErrorAs(t, err, &e)
 	})
+	t.Run("Timeout", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer ts.Close()
+		opts := Options{URL: ts.URL, MaxAttempts: 1, Timeout: 10 * time.Millisecond}
+		z, err := New("someapikey", opts)
+		assert.Nil(t, z)
+		var e *ErrMakeReq
+		assert.ErrorAs(t, err, &e)
+	})
+	t.Run("Timeout reading", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer ts.Close()
+		opts := Options{URL: ts.URL, MaxAttempts: 1, Timeout: 10 * time.Millisecond}
+		z, err := New("someapikey", opts)
+		assert.Nil(t, z)
+		var e *ErrReadBody
+		assert.ErrorAs(t, err, &e)
+	})
 	t.Run("Not OK reply", func(t *testing.T) {
 		ts := httptest.NewServer(http.NotFoundHandler())
 		defer ts.Close()
-		z, err := newWithURL(ts.URL, "someapikey")
+		z, err := New("someapikey", Options{URL: ts.URL, MaxAttempts: 1})
 		require.Error(t, err)
 		assert.Nil(t, z)
 		var e *ErrWrongStatus
 		assert.ErrorAs(t, err, &e)
 	})
+	t.Run("Invalid key", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(w, "Invalid key")
+		}))
+		defer ts.Close()
+		_, err := New("someapikey", Options{URL: ts.URL, MaxAttempts: 1})
+		var e *ErrWrongStatus
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, http.StatusForbidden, e.Status())
+		assert.Equal(t, ts.URL+"/keys/current", e.URL())
+		assert.Equal(t, "Invalid key", e.Body())
+		assert.EqualError(t, err, "received 403 status code instead of 200 from "+ts.URL+"/keys/current: Invalid key")
+	})
+	t.Run("Empty error reply", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+		}))
+		defer ts.Close()
+		_, err := New("someapikey", Options{URL: ts.URL, MaxAttempts: 1})
+		var e *ErrWrongStatus
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, "Conflict", e.Body())
+	})
 	t.Run("Invalid JSON reply", func(t *testing.T) {
 		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprintln(w, "invalidjson")
 		}))
 		defer ts.Close()
-		z, err := newWithURL(ts.URL, "someapikey")
+		z, err := New("someapikey", Options{URL: ts.URL, MaxAttempts: 1})
 		require.Error(t, err)
 		assert.Nil(t, z)
 		var e *ErrJSON
@@ -87,11 +142,79 @@ func TestNewWithURL(t *testing.T) {
 	})
 }
 
+func TestNewTransport(t *testing.T) {
+	keyReply := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, keyReplyFmt, "someapikey", 1337, "myusername")
+	}
+	t.Run("User-Agent", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/keys/current", r.URL.Path)
+			assert.Equal(t, "zotools-test", r.Header.Get("User-Agent"))
+			keyReply(w, r)
+		}))
+		defer ts.Close()
+		_, err := New("someapikey", Options{URL: ts.URL + "/", UserAgent: "zotools-test"})
+		assert.NoError(t, err)
+	})
+	t.Run("Proxy", func(t *testing.T) {
+		proxied := false
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "zotero.example.com", r.Host)
+			proxied = true
+			keyReply(w, r)
+		}))
+		defer proxy.Close()
+		_, err := New("someapikey", Options{URL: "http://zotero.example.com", Proxy: proxy.URL})
+		assert.NoError(t, err)
+		assert.True(t, proxied)
+	})
+	t.Run("Invalid proxy", func(t *testing.T) {
+		_, err := New("someapikey", Options{Proxy: "http://proxy:port"})
+		var e *ErrProxyURL
+		assert.ErrorAs(t, err, &e)
+	})
+	t.Run("CA bundle", func(t *testing.T) {
+		ts := httptest.NewTLSServer(http.HandlerFunc(keyReply))
+		defer ts.Close()
+		bundle := filepath.Join(t.TempDir(), "ca.pem")
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+		require.NoError(t, os.WriteFile(bundle, cert, 0o600))
+		_, err := New("someapikey", Options{URL: ts.URL, MaxAttempts: 1})
+		var e *ErrMakeReq
+		assert.ErrorAs(t, err, &e)
+		_, err = New("someapikey", Options{URL: ts.URL, MaxAttempts: 1, CABundle: bundle})
+		assert.NoError(t, err)
+	})
+	t.Run("Invalid CA bundle", func(t *testing.T) {
+		bundle := filepath.Join(t.TempDir(), "ca.pem")
+		_, err := New("someapikey", Options{CABundle: bundle})
+		var eRead *ErrReadCA
+		assert.ErrorAs(t, err, &eRead)
+		require.NoError(t, os.WriteFile(bundle, []byte("not a certificate"), 0o600))
+		_, err = New("someapikey", Options{CABundle: bundle})
+		var eCerts *ErrNoCerts
+		assert.ErrorAs(t, err, &eCerts)
+	})
+}
+
+var userLib = Library{UserLibrary, 1337, "myusername"}
+
 //go:embed assets/items.json
 var itemsReply string
 
 const itemsReplyCount = 10
 
+// itemsPage collects the items of the page starting at start
+func itemsPage(z *Zotero, lib Library, since, start uint) ([]Item, uint, uint64, error) {
+	items := []Item{}
+	version, total, err := z.streamItems(context.Background(), lib, since, start, 0,
+		func(item *Item) error {
+			items = append(items, *item)
+			return nil
+		})
+	return items, version, total, err
+}
+
 func TestItems(t *testing.T) {
 	itemsReplyCountS := fmt.Sprint(itemsReplyCount)
 	t.Run("Successful - no more", func(t *testing.T) {
@@ -106,35 +229,47 @@ func TestItems(t *testing.T) {
 			fmt.Fprint(w, itemsReply)
 		}))
 		defer ts.Close()
-		res, more, err := zotFromServer(ts).Items(start, MaxLimit)
+		items, v, total, err := itemsPage(zotFromServer(ts), userLib, 0, start)
 		require.NoError(t, err)
-		assert.Falsef(t, more, "expected no more items")
-		assert.Equal(t, res.Version, version)
-		assert.Len(t, res.Items, itemsReplyCount)
+		assert.Equal(t, uint64(itemsReplyCount), total)
+		assert.Equal(t, v, version)
+		assert.Len(t, items, itemsReplyCount)
 	})
 	t.Run("Successful - more", func(t *testing.T) {
-		const start, limit, version uint = 0, itemsReplyCount, 42
+		const start, version uint = MaxLimit, 42
 		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			const tot uint = 100
-			require.Greater(t, tot, limit)
-			w.Header().Add(totalResHeader, fmt.Sprint(tot))
+			assert.Equal(t, fmt.Sprint(start), r.URL.Query().Get("start"))
+			w.Header().Add(totalResHeader, fmt.Sprint(3*MaxLimit))
 			w.Header().Add(lastModifiedHeader, fmt.Sprint(version))
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprint(w, itemsReply)
 		}))
 		defer ts.Close()
-		res, more, err := zotFromServer(ts).Items(start, limit)
+		items, v, total, err := itemsPage(zotFromServer(ts), userLib, 0, start)
 		require.NoError(t, err)
-		assert.Truef(t, more, "expected more items")
-		assert.Equal(t, res.Version, version)
-		assert.Len(t, res.Items, int(limit))
+		assert.Equal(t, uint64(3*MaxLimit), total)
+		assert.Equal(t, v, version)
+		assert.Len(t, items, itemsReplyCount)
+	})
+	t.Run("Successful - since", func(t *testing.T) {
+		const since, version uint = 1337, 1400
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, fmt.Sprint(since), r.URL.Query().Get("since"))
+			w.Header().Add(totalResHeader, itemsReplyCountS)
+			w.Header().Add(lastModifiedHeader, fmt.Sprint(version))
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, itemsReply)
+		}))
+		defer ts.Close()
+		_, v, _, err := itemsPage(zotFromServer(ts), userLib, since, 0)
+		require.NoError(t, err)
+		assert.Equal(t, v, version)
 	})
 	t.Run("Failed request", func(t *testing.T) {
 		ts := httptest.NewUnstartedServer(nil)
 		defer ts.Close()
-		res, _, err := zotFromServer(ts).Items(0, MaxLimit)
+		_, _, _, err := itemsPage(zotFromServer(ts), userLib, 0, 0)
 		require.Error(t, err)
-		assert.Nil(t, res)
 		var e *ErrMakeReq
 		assert.ErrorAs(t, err, &e)
 		var inner *url.Error
@@ -142,18 +277,17 @@ func TestItems(t *testing.T) {
 	})
 	t.Run("Broken URL", func(t *testing.T) {
 		var client http.Client
-		z := Zotero{"someapikey", "http://bad\x00url.com", client, apiKey{}}
-		res, _, err := z.Items(0, MaxLimit)
+		z := Zotero{key: "someapikey", url: "http://bad\x00url.com", client: client, maxAttempts: 1,
+			userInfo: fullAccess}
+		_, _, _, err := itemsPage(&z, userLib, 0, 0)
 		require.Error(t, err)
-		assert.Nil(t, res)
 		var e *ErrWrongURL
 		assert.ErrorAs(t, err, &e)
 	})
 	t.Run("Status not OK", func(t *testing.T) {
 		ts := httptest.NewServer(http.NotFoundHandler())
 		defer ts.Close()
-		res, _, err := zotFromServer(ts).Items(0, MaxLimit)
-		assert.Nil(t, res)
+		_, _, _, err := itemsPage(zotFromServer(ts), userLib, 0, 0)
 		assert.Error(t, err)
 		var e *ErrWrongStatus
 		assert.ErrorAs(t, err, &e)
@@ -166,8 +300,7 @@ func TestItems(t *testing.T) {
 			fmt.Fprint(w, itemsReply)
 		}))
 		defer ts.Close()
-		res, _, err := zotFromServer(ts).Items(0, MaxLimit)
-		assert.Nil(t, res)
+		_, _, _, err := itemsPage(zotFromServer(ts), userLib, 0, 0)
 		assert.Error(t, err)
 		var e *ErrParseHeader
 		assert.ErrorAs(t, err, &e)
@@ -181,9 +314,8 @@ func TestItems(t *testing.T) {
 			fmt.Fprintln(w, "invalidjson")
 		}))
 		defer ts.Close()
-		res, _, err := zotFromServer(ts).Items(0, MaxLimit)
+		_, _, _, err := itemsPage(zotFromServer(ts), userLib, 0, 0)
 		require.Error(t, err)
-		assert.Nil(t, res)
 		var e *ErrJSON
 		assert.ErrorAs(t, err, &e)
 		var inner *json.SyntaxError
@@ -197,8 +329,7 @@ func TestItems(t *testing.T) {
 			fmt.Fprint(w, itemsReply)
 		}))
 		defer ts.Close()
-		res, _, err := zotFromServer(ts).Items(0, MaxLimit)
-		assert.Nil(t, res)
+		_, _, _, err := itemsPage(zotFromServer(ts), userLib, 0, 0)
 		assert.Error(t, err)
 		var e *ErrParseHeader
 		assert.ErrorAs(t, err, &e)
@@ -206,7 +337,23 @@ func TestItems(t *testing.T) {
 	})
 }
 
-func TestAllItems(t *testing.T) {
+type itemsResult struct {
+	Items   []Item
+	Version uint
+}
+
+// allItems collects the items that EachItem goes through
+func allItems(z *Zotero, lib Library, since uint) (itemsResult, error) {
+	res := itemsResult{Items: []Item{}}
+	version, err := z.EachItem(lib, since, func(item *Item) error {
+		res.Items = append(res.Items, *item)
+		return nil
+	})
+	res.Version = version
+	return res, err
+}
+
+func TestEachItemPages(t *testing.T) {
 	t.Run("Successful single", func(t *testing.T) {
 		const version uint = 42
 		requests := 0
@@ -218,7 +365,7 @@ func TestAllItems(t *testing.T) {
 			requests++
 		}))
 		defer ts.Close()
-		res, err := zotFromServer(ts).AllItems()
+		res, err := allItems(zotFromServer(ts), userLib, 0)
 		assert.NoError(t, err)
 		assert.Equal(t, res.Version, version)
 		assert.Len(t, res.Items, itemsReplyCount)
@@ -235,25 +382,348 @@ func TestAllItems(t *testing.T) {
 			requests++
 		}))
 		defer ts.Close()
-		res, err := zotFromServer(ts).AllItems()
+		res, err := allItems(zotFromServer(ts), userLib, 0)
 		assert.NoError(t, err)
 		assert.Equal(t, res.Version, version)
 		assert.Len(t, res.Items, itemsReplyCount*2)
 		assert.Equal(t, requests, 2)
 	})
+	t.Run("Concurrent pages in order", func(t *testing.T) {
+		const pages = 5
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add(totalResHeader, fmt.Sprint(MaxLimit*pages))
+			w.Header().Add(lastModifiedHeader, "42")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `[{"key":"%s","version":1,"data":{}}]`, r.URL.Query().Get("start"))
+		}))
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.jobs = 3
+		res, err := allItems(z, userLib, 0)
+		require.NoError(t, err)
+		keys := []string{}
+		for _, item := range res.Items {
+			keys = append(keys, item.Key)
+		}
+		assert.Equal(t, []string{"0", "100", "200", "300", "400"}, keys)
+	})
+	t.Run("Library changed", func(t *testing.T) {
+		var mu sync.Mutex
+		requests := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests++
+			version := requests
+			mu.Unlock()
+			w.Header().Add(totalResHeader, fmt.Sprint(MaxLimit*2))
+			w.Header().Add(lastModifiedHeader, fmt.Sprint(version))
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, itemsReply)
+		}))
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.maxAttempts = 2
+		_, err := allItems(z, userLib, 0)
+		var e *ErrLibraryChanged
+		assert.ErrorAs(t, err, &e)
+		assert.Equal(t, 4, requests)
+	})
+	t.Run("Not modified", func(t *testing.T) {
+		requests := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			assert.Equal(t, "42", r.Header.Get(ifModifiedHeader))
+			w.WriteHeader(http.StatusNotModified)
+		}))
+		defer ts.Close()
+		_, err := allItems(zotFromServer(ts), userLib, 42)
+		var e *ErrNotModified
+		assert.ErrorAs(t, err, &e)
+		assert.Equal(t, 1, requests)
+	})
+	t.Run("Modified", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("start") == "0" {
+				assert.Equal(t, "42", r.Header.Get(ifModifiedHeader))
+			} else {
+				assert.Empty(t, r.Header.Get(ifModifiedHeader))
+			}
+			w.Header().Add(totalResHeader, fmt.Sprint(MaxLimit*2))
+			w.Header().Add(lastModifiedHeader, "43")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, itemsReply)
+		}))
+		defer ts.Close()
+		res, err := allItems(zotFromServer(ts), userLib, 42)
+		require.NoError(t, err)
+		assert.Equal(t, uint(43), res.Version)
+	})
 	t.Run("Error Items", func(t *testing.T) {
 		ts := httptest.NewServer(http.NotFoundHandler())
 		defer ts.Close()
-		_, err := zotFromServer(ts).AllItems()
+		_, err := allItems(zotFromServer(ts), userLib, 0)
 		var e *ErrWrongStatus
 		assert.ErrorAs(t, err, &e)
 	})
 }
 
+func TestLibraries(t *testing.T) {
+	t.Run("Successful", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/users/1337/groups", r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `[{"id":42,"version":3,"data":{"id":42,"name":"Team"}}]`)
+		}))
+		defer ts.Close()
+		z := zotFromServer(ts)
+		z.userInfo.UserID, z.userInfo.Username = 1337, "myusername"
+		libs, err := z.Libraries()
+		require.NoError(t, err)
+		assert.Equal(t, []Library{userLib, {GroupLibrary, 42, "Team"}}, libs)
+	})
+	t.Run("Invalid JSON reply", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "invalidjson")
+		}))
+		defer ts.Close()
+		libs, err := zotFromServer(ts).Libraries()
+		assert.Nil(t, libs)
+		var e *ErrJSON
+		assert.ErrorAs(t, err, &e)
+	})
+}
+
+func TestItemsGroup(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/groups/42/items", r.URL.Path)
+		w.Header().Add(totalResHeader, fmt.Sprint(itemsReplyCount))
+		w.Header().Add(lastModifiedHeader, "1")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, itemsReply)
+	}))
+	defer ts.Close()
+	items, _, _, err := itemsPage(zotFromServer(ts), Library{GroupLibrary, 42, "Team"}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, items, itemsReplyCount)
+}
+
+func TestAllCollections(t *testing.T) {
+	t.Run("Successful", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/users/1337/collections", r.URL.Path)
+			assert.Equal(t, "42", r.URL.Query().Get("since"))
+			w.Header().Add(totalResHeader, "2")
+			w.Header().Add(lastModifiedHeader, "1400")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `[
+				{"key":"C1","version":1,"data":{"key":"C1","name":"Thesis","parentCollection":false}},
+				{"key":"C2","version":2,"data":{"key":"C2","name":"Related work","parentCollection":"C1"}}
+			]`)
+		}))
+		defer ts.Close()
+		res, err := zotFromServer(ts).AllCollections(userLib, 42)
+		require.NoError(t, err)
+		assert.Equal(t, uint(1400), res.Version)
+		require.Len(t, res.Collections, 2)
+		assert.Equal(t, ParentKey(""), res.Collections[0].Data.ParentKey)
+		assert.Equal(t, ParentKey("C1"), res.Collections[1].Data.ParentKey)
+		assert.Equal(t, "Related work", res.Collections[1].Data.Name)
+	})
+	t.Run("Status not OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		defer ts.Close()
+		_, err := zotFromServer(ts).AllCollections(userLib, 0)
+		var e *ErrWrongStatus
+		assert.ErrorAs(t, err, &e)
+	})
+}
+
+func TestFulltextVersions(t *testing.T) {
+	t.Run("Successful", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/users/1337/fulltext", r.URL.Path)
+			assert.Equal(t, "42", r.URL.Query().Get("since"))
+			w.Header().Add(lastModifiedHeader, "1400")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"A1":1399,"A2":1400}`)
+		}))
+		defer ts.Close()
+		versions, version, err := zotFromServer(ts).FulltextVersions(userLib, 42)
+		require.NoError(t, err)
+		assert.Equal(t, uint(1400), version)
+		assert.Equal(t, map[string]uint{"A1": 1399, "A2": 1400}, versions)
+	})
+	t.Run("Wrong version header", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{}`)
+		}))
+		defer ts.Close()
+		_, _, err := zotFromServer(ts).FulltextVersions(userLib, 0)
+		var e *ErrParseHeader
+		assert.ErrorAs(t, err, &e)
+	})
+}
+
+func TestItemFulltext(t *testing.T) {
+	t.Run("Successful", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/users/1337/items/A1/fulltext", r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"content":"Some text","indexedPages":2,"totalPages":2}`)
+		}))
+		defer ts.Close()
+		ft, err := zotFromServer(ts).ItemFulltext(userLib, "A1")
+		require.NoError(t, err)
+		assert.Equal(t, "Some text", ft.Content)
+		assert.Equal(t, uint(2), ft.TotalPages)
+	})
+	t.Run("Not indexed", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		defer ts.Close()
+		ft, err := zotFromServer(ts).ItemFulltext(userLib, "A1")
+		assert.NoError(t, err)
+		assert.Nil(t, ft)
+	})
+	t.Run("Status not OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer ts.Close()
+		ft, err := zotFromServer(ts).ItemFulltext(userLib, "A1")
+		assert.Nil(t, ft)
+		var e *ErrWrongStatus
+		assert.ErrorAs(t, err, &e)
+	})
+}
+
+func TestFile(t *testing.T) {
+	t.Run("Successful", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/groups/42/items/A1/file", r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "%PDF-1.5")
+		}))
+		defer ts.Close()
+		file, err := zotFromServer(ts).File(Library{GroupLibrary, 42, "Team"}, "A1")
+		require.NoError(t, err)
+		defer file.Close()
+		content, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, "%PDF-1.5", string(content))
+	})
+	t.Run("Slow download", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprint(w, "%PDF-1.5")
+		}))
+		defer ts.Close()
+		z := zotFromServer(ts)
+		client, err := newClient(Options{}, 10*time.Millisecond)
+		require.NoError(t, err)
+		z.client, z.timeout = client, 10*time.Millisecond
+		file, err := z.File(userLib, "A1")
+		require.NoError(t, err)
+		defer file.Close()
+		content, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, "%PDF-1.5", string(content))
+	})
+	t.Run("Status not OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		defer ts.Close()
+		file, err := zotFromServer(ts).File(userLib, "A1")
+		assert.Nil(t, file)
+		var e *ErrWrongStatus
+		assert.ErrorAs(t, err, &e)
+	})
+}
+
+func TestDeleted(t *testing.T) {
+	t.Run("Successful", func(t *testing.T) {
+		const since, version uint = 1337, 1400
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, fmt.Sprint(since), r.URL.Query().Get("since"))
+			w.Header().Add(lastModifiedHeader, fmt.Sprint(version))
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"collections":["C1"],"searches":[],"items":["I1","I2"],"tags":["t"],"settings":[]}`)
+		}))
+		defer ts.Close()
+		res, err := zotFromServer(ts).Deleted(userLib, since)
+		require.NoError(t, err)
+		assert.Equal(t, version, res.Version)
+		assert.Equal(t, []string{"I1", "I2"}, res.Items)
+		assert.Equal(t, []string{"C1"}, res.Collections)
+		assert.Equal(t, []string{"t"}, res.Tags)
+	})
+	t.Run("Status not OK", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		defer ts.Close()
+		res, err := zotFromServer(ts).Deleted(userLib, 0)
+		assert.Nil(t, res)
+		var e *ErrWrongStatus
+		assert.ErrorAs(t, err, &e)
+	})
+	t.Run("Invalid JSON reply", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add(lastModifiedHeader, "42")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "invalidjson")
+		}))
+		defer ts.Close()
+		res, err := zotFromServer(ts).Deleted(userLib, 0)
+		assert.Nil(t, res)
+		var e *ErrJSON
+		assert.ErrorAs(t, err, &e)
+	})
+}
+
+func TestItemDataFields(t *testing.T) {
+	var data ItemData
+	raw := `{"key": "K1", "title": "Title", "itemType": "journalArticle", "date": "2021-03-01",
+		"DOI": "10.1000/xyz", "volume": "", "creators": [], "tags": []}`
+	require.NoError(t, json.Unmarshal([]byte(raw), &data))
+	assert.Equal(t, "Title", data.Title)
+	assert.Equal(t, "journalArticle", data.ItemType)
+	assert.Equal(t, map[string]string{"date": "2021-03-01", "DOI": "10.1000/xyz"}, data.Fields)
+
+	var items []Item
+	require.NoError(t, json.Unmarshal([]byte(itemsReply), &items))
+	assert.Equal(t, "https://www.zotero.org/blog/a-unified-zotero-experience/", items[0].Data.URL)
+	assert.NotContains(t, items[0].Data.Fields, "url")
+
+	raw = `{"key": "A1", "itemType": "attachment", "linkMode": "linked_url", "url": "https://example.com",
+		"path": "", "accessDate": "2021-03-01"}`
+	data = ItemData{}
+	require.NoError(t, json.Unmarshal([]byte(raw), &data))
+	assert.Equal(t, "linked_url", data.LinkMode)
+	assert.Equal(t, "https://example.com", data.URL)
+	assert.Equal(t, map[string]string{"accessDate": "2021-03-01"}, data.Fields)
+}
+
+func TestFlag(t *testing.T) {
+	var data ItemData
+	require.NoError(t, json.Unmarshal([]byte(`{"deleted": 1}`), &data))
+	assert.True(t, bool(data.Deleted))
+	require.NoError(t, json.Unmarshal([]byte(`{"deleted": false}`), &data))
+	assert.False(t, bool(data.Deleted))
+	err := json.Unmarshal([]byte(`{"deleted": "yes"}`), &data)
+	var e *ErrInvalidFlag
+	assert.ErrorAs(t, err, &e)
+}
+
+var fullAccess = KeyInfo{Access: Access{
+	User:   Rights{Library: true, Files: true, Notes: true, Write: true},
+	Groups: map[string]Rights{"all": {Library: true, Write: true}},
+}}
+
 func zotFromServer(ts *httptest.Server) *Zotero {
 	client := ts.Client()
 	if client == nil {
 		client = http.DefaultClient
 	}
-	return &Zotero{"someapikey", ts.URL, *client, apiKey{}}
+	return &Zotero{key: "someapikey", url: ts.URL, client: *client, maxAttempts: 1, userInfo: fullAccess}
 }
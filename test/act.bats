@@ -2,6 +2,8 @@
 
 load helpers
 
+SINGLE_RES_FILENAME="Drozd and Wagner - 2018 - FuzzerGym A Competitive Framework for Fuzzing and.pdf"
+
 @test "Act forget empty" {
     cp_storage empty
     run_zotools act -forget
@@ -48,6 +50,7 @@ load helpers
 
 @test "Act known MIME action" {
     cp_storage single_result
+    cp_attachment 5D9UT6I4 "$SINGLE_RES_FILENAME"
     ZOTOOLS_PDF=echo run_zotools act
     [ "$status" -eq 0 ]
     [[ "${lines[1]}" =~ "5D9UT6I4" ]]
@@ -71,6 +74,6 @@ load helpers
     cp_storage single_result
     run_zotools act hopefullythisprogramisnotavailableanywhereweruntests
     [ "$status" -eq 1 ]
-    [[ "${lines[0]}" =~ "5D9UT6I4" ]]
     [[ "$output" =~ "Failed to run action" ]]
+    [[ ! "$output" =~ "5D9UT6I4" ]]
 }
@@ -41,6 +41,10 @@ setup() {
 
 teardown() {
     rm "$CONFIG" "$STORAGE"
+    rm -f "$ASSETS"/*.lock
+    if [ -n "$ZOTERO_DIR" ]; then
+        rm -r "$ZOTERO_DIR"
+    fi
 }
 
 cp_config() {
@@ -68,6 +72,16 @@ cp_storage() {
     esac
 }
 
+# Creates the stored file of the attachment in a temporary Zotero folder, so
+# that act does not download it
+cp_attachment() {
+    local key=$1 filename=$2
+    ZOTERO_DIR=$(mktemp -d)
+    mkdir -p "$ZOTERO_DIR/storage/$key"
+    touch "$ZOTERO_DIR/storage/$key/$filename"
+    sed "s|\"pathtozotero\"|\"$ZOTERO_DIR\"|" "$CONFIG_SRC" > "$CONFIG"
+}
+
 storage_contents() {
     cat "$STORAGE"
 }